@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
 
 	"github.com/chzyer/readline"
@@ -11,50 +15,103 @@ import (
 	"github.com/windlant/mcp-client/internal/config"
 	"github.com/windlant/mcp-client/internal/model"
 	"github.com/windlant/mcp-client/internal/tools"
+	"github.com/windlant/mcp-client/internal/tools/composite"
 	"github.com/windlant/mcp-client/internal/tools/local"
+	"github.com/windlant/mcp-client/internal/tools/remote"
 	"github.com/windlant/mcp-client/internal/tools/stdio"
 )
 
 func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run 初始化模型与工具客户端并运行交互循环
+// 所有错误都返回给 main 统一退出，保证已启动的 MCP 服务器在退出前通过 defer 关闭
+func run() error {
 	cfg, err := config.Load()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
-		fmt.Fprintln(os.Stderr, "请确保 'config/config.yaml' 文件存在。")
-		os.Exit(1)
+		return fmt.Errorf("加载配置失败: %w\n请确保 'config/config.yaml' 文件存在。", err)
 	}
 
-	m, err := model.NewDeepSeekModel(cfg)
+	// 根据配置选择模型提供方
+	var m model.Model
+	switch cfg.Model.Provider {
+	case "deepseek":
+		m, err = model.NewDeepSeekModel(cfg)
+	case "openai", "openai_compatible":
+		m, err = model.NewOpenAICompatModel(cfg)
+	case "anthropic":
+		m, err = model.NewAnthropicModel(cfg)
+	case "ollama":
+		m, err = model.NewOllamaModel(cfg)
+	default:
+		err = fmt.Errorf("不支持的模型提供方: %s。支持的提供方: deepseek, openai, openai_compatible, anthropic, ollama", cfg.Model.Provider)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "初始化模型失败: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("初始化模型失败: %w", err)
+	}
+
+	// 模型不支持原生工具调用时，改用基于提示词的工具调用协议
+	switch cfg.Model.ToolMode {
+	case "native":
+	case "prompt":
+		m = model.NewPromptToolModel(m)
+	default:
+		return fmt.Errorf("不支持的工具调用方式: %s。支持的方式: native, prompt", cfg.Model.ToolMode)
 	}
 
 	var tc tools.ToolClient
 
-	// 根据配置选择工具调用模式：local（直接调用）或 stdio（子进程服务器）
+	// 根据配置选择工具调用模式：local（直接调用）或 mcp（连接 mcp_servers 中的服务器，stdio 与 remote 为其旧名称）
 	if cfg.Tools.Enabled {
 		switch cfg.Tools.Mode {
 		case "local":
 			tc = local.NewLocalToolClient()
 			fmt.Println("使用本地工具客户端（直接函数调用）。")
 
-		case "stdio":
-			serverBinary := "./cmd/mcp_server_local/mcp-server-local"
-			tc, err = stdio.NewStdioToolClient(serverBinary)
-			if err != nil {
-				log.Fatalf("启动 stdio 工具客户端失败: %v", err)
+		case "mcp", "stdio", "remote":
+			if len(cfg.MCPServers) == 0 {
+				return errors.New("所有 MCP 服务器都已被禁用（disabled: true），请至少启用一个服务器，或将 tools.mode 设为 local")
 			}
+			ctc := startMCPServers(cfg.MCPServers)
 			defer func() {
-				_ = tc.Close()
+				_ = ctc.Close()
 			}()
-			fmt.Println("使用 stdio 工具客户端（子进程 MCP 服务器）。")
+			if ctc.Len() == 0 {
+				return errors.New("没有可用的 MCP 服务器")
+			}
+			tc = ctc
+			fmt.Printf("使用 MCP 工具客户端（%d 个 MCP 服务器）。\n", ctc.Len())
 
 		default:
-			log.Fatalf("不支持的工具模式: %s。支持的模式: local, stdio", cfg.Tools.Mode)
+			return fmt.Errorf("不支持的工具模式: %s。支持的模式: local, mcp", cfg.Tools.Mode)
 		}
 	}
 
 	a := agent.NewAgent(m, cfg.Context.MaxHistory, cfg.Tools.Enabled, tc)
+	a.SetTokenBudget(cfg.Context.MaxTokens, cfg.Context.ReserveTokens, cfg.Context.MaxToolResultTokens)
+	a.SetCompaction(agent.CompactionOptions{
+		Enabled:    cfg.Context.CompactEnabled,
+		Threshold:  cfg.Context.CompactThreshold,
+		KeepRecent: cfg.Context.CompactKeepRecent,
+		Prompt:     cfg.Context.SummaryPrompt,
+	})
+	a.SetToolExecution(agent.ToolExecOptions{
+		MaxParallel: cfg.Tools.MaxParallel,
+		Timeout:     cfg.Tools.CallTimeout,
+		Sequential:  cfg.Tools.Sequential,
+	})
+	if price, ok := cfg.Pricing.Models[cfg.Model.ModelName]; ok {
+		a.SetPrice(agent.Price{
+			Prompt:       price.Prompt,
+			Completion:   price.Completion,
+			CachedPrompt: price.CachedPrompt,
+		})
+	}
+	currency := cfg.Pricing.Currency
 
 	fmt.Println("MCP 客户端已启动！")
 	if cfg.Tools.Enabled {
@@ -63,18 +120,24 @@ func main() {
 		fmt.Println("工具调用: 已禁用")
 	}
 	fmt.Printf("最大上下文消息数: %d\n", cfg.Context.MaxHistory)
-	fmt.Println("输入 'exit' 退出，输入 'clear' 清空对话历史。")
+	if cfg.Context.MaxTokens > 0 {
+		fmt.Printf("上下文 token 预算: %d（预留回复 %d）\n", cfg.Context.MaxTokens, cfg.Context.ReserveTokens)
+	}
+	fmt.Println("输入 'exit' 退出，输入 'clear' 清空对话历史，输入 '/usage' 查看用量，输入 '/compact' 压缩对话历史，回复过程中按 Ctrl+C 取消当前请求。")
 
 	rl, err := readline.New("You: ")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "初始化输入读取器失败: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("初始化输入读取器失败: %w", err)
 	}
 	defer rl.Close()
 
 	// 主交互循环：不断读取用户输入并让智能体回复
 	for {
 		line, err := rl.Readline()
+		if err == readline.ErrInterrupt {
+			// 在输入提示处按 Ctrl+C 只清空当前输入，不退出程序
+			continue
+		}
 		if err != nil {
 			// 处理 EOF（Ctrl+D）或读取错误
 			break
@@ -89,20 +152,213 @@ func main() {
 		switch input {
 		case "exit":
 			fmt.Println("再见！")
-			return
+			return nil
 		case "clear":
 			a.ClearHistory()
 			fmt.Println("对话历史已清空。")
 			continue
+		case "/compact":
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			compacted, err := a.Compact(ctx)
+			stop()
+			switch {
+			case err != nil:
+				printChatError(err)
+			case compacted:
+				fmt.Println("较早的对话已压缩为摘要。")
+			default:
+				fmt.Println("对话历史较短，无需压缩。")
+			}
+			continue
+		case "/usage":
+			fmt.Printf("上一轮: %s\n", formatUsage(a, a.LastTurnUsage(), currency))
+			fmt.Printf("本次会话: %s\n\n", formatUsage(a, a.SessionUsage(), currency))
+			continue
+		}
+
+		// 将用户输入交给智能体处理；每轮使用独立的 ctx，Ctrl+C 只取消当前这一轮
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		if cfg.Model.Stream {
+			chatStream(ctx, a, input)
+		} else {
+			chat(ctx, a, input)
+		}
+		stop()
+
+		// 每轮结束后输出本轮用量
+		if turn := a.LastTurnUsage(); turn.Requests > 0 {
+			fmt.Printf("[%s]\n\n", formatUsage(a, turn, currency))
 		}
+	}
+
+	return nil
+}
 
-		// 将用户输入交给智能体处理
-		reply, err := a.Chat(input)
+// startMCPServers 按服务器名顺序连接配置中的 MCP 服务器并聚合为一个工具客户端
+// 连接失败的服务器会被跳过并打印提示
+func startMCPServers(servers map[string]config.MCPServerConfig) *composite.CompositeToolClient {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ctc := composite.NewCompositeToolClient()
+	ctc.SetErrorHandler(func(server string, err error) {
+		fmt.Fprintf(os.Stderr, "获取 MCP 服务器 %s 的工具列表失败: %v\n", server, err)
+	})
+	for _, name := range names {
+		// stdio 服务器重启后工具可能变化，立即更新聚合客户端的路由
+		onRestart := func(defs []tools.ToolDefinition) { ctc.SetTools(name, defs) }
+		client, err := connectMCPServer(name, servers[name], onRestart)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "处理请求时出错: %v\n", err)
+			fmt.Fprintf(os.Stderr, "连接 MCP 服务器 %s 失败: %v\n", name, err)
 			continue
 		}
+		ctc.Add(name, client)
+	}
+	return ctc
+}
+
+// connectMCPServer 按服务器配置的传输方式创建工具客户端，stdio 服务器重启后以新的工具列表调用 onRestart
+func connectMCPServer(name string, srv config.MCPServerConfig, onRestart func([]tools.ToolDefinition)) (tools.ToolClient, error) {
+	switch srv.Transport() {
+	case "stdio":
+		sink, err := stderrSink(name, srv.StderrLog)
+		if err != nil {
+			return nil, err
+		}
+		return stdio.NewSupervisedClient(stdio.Options{
+			Command: srv.Command,
+			Args:    srv.Args,
+			Env:     srv.Env,
+			Dir:     srv.Cwd,
+
+			StartupTimeout: srv.StartupTimeout,
+			Stderr:         sink,
+			StderrLines:    srv.StderrLines,
+
+			Restart:             stdio.RestartPolicy(srv.Restart),
+			MaxRestarts:         srv.MaxRestarts,
+			HealthCheckInterval: srv.HealthCheckInterval,
+			Logf: func(format string, args ...interface{}) {
+				fmt.Fprintf(os.Stderr, "MCP 服务器 %s: %s\n", name, fmt.Sprintf(format, args...))
+			},
+			OnRestart: onRestart,
+		})
+	case "http":
+		return remote.NewToolClient(remote.Options{
+			URL:     srv.URL,
+			Headers: srv.Headers,
+		})
+	case "sse":
+		return remote.NewSSEToolClient(remote.Options{
+			URL:     srv.URL,
+			Headers: srv.Headers,
+		})
+	default:
+		return nil, fmt.Errorf("不支持的传输方式: %s。支持的方式: stdio, http, sse", srv.Transport())
+	}
+}
+
+// stderrSink 按 stderr_log 配置返回 stdio 服务器 stderr 输出的转发目标，为空时返回 nil（只保留在内存中）
+// 返回值交给 stdio 客户端，由其在服务器关闭时关闭
+func stderrSink(name, target string) (io.WriteCloser, error) {
+	switch target {
+	case "":
+		return nil, nil
+	case "stderr":
+		return &prefixWriter{prefix: "[" + name + "] ", w: os.Stderr}, nil
+	default:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("打开 stderr 日志文件失败: %w", err)
+		}
+		return f, nil
+	}
+}
 
-		fmt.Printf("Agent: %s\n\n", reply)
+// prefixWriter 在每次写入前加上固定前缀，用于区分多个服务器转发到同一终端的输出
+// stdio 客户端每次写入一整行，因此按写入加前缀即可
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(p.w, p.prefix+string(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close 不关闭底层的 w（os.Stderr 由多个服务器共用）
+func (p *prefixWriter) Close() error {
+	return nil
+}
+
+// chat 以非流式方式处理一轮对话，等待完整回复后一次性打印
+func chat(ctx context.Context, a *agent.Agent, input string) {
+	reply, err := a.Chat(ctx, input)
+	if err != nil {
+		printChatError(err)
+		return
 	}
+
+	fmt.Printf("Agent: %s\n\n", reply)
+}
+
+// formatUsage 将用量统计格式化为一行文本，配置了价格时附带费用
+func formatUsage(a *agent.Agent, s agent.UsageStats, currency string) string {
+	text := fmt.Sprintf("请求 %d 次，输入 %d tokens（缓存命中 %d），输出 %d tokens",
+		s.Requests, s.Usage.PromptTokens, s.Usage.CachedPromptTokens, s.Usage.CompletionTokens)
+	if a.HasPrice() {
+		text += fmt.Sprintf("，费用 %s%.4f", currency, s.Cost)
+	}
+	return text
+}
+
+// printChatError 打印一轮对话失败的原因，被 Ctrl+C 取消时给出单独的提示
+func printChatError(err error) {
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "已取消当前请求。")
+		return
+	}
+	fmt.Fprintf(os.Stderr, "处理请求时出错: %v\n", err)
+}
+
+// chatStream 以流式方式处理一轮对话，实时打印模型输出与工具调用进度
+func chatStream(ctx context.Context, a *agent.Agent, input string) {
+	fmt.Print("Agent: ")
+	atLineStart := false
+
+	_, err := a.ChatStream(ctx, input, func(ev agent.Event) {
+		switch ev.Type {
+		case agent.EventToken:
+			fmt.Print(ev.Text)
+			atLineStart = strings.HasSuffix(ev.Text, "\n")
+		case agent.EventToolCallStarted:
+			if !atLineStart {
+				fmt.Println()
+			}
+			fmt.Printf("[调用工具 %s]\n", ev.ToolCall.Function.Name)
+			atLineStart = true
+		case agent.EventToolCallFinished:
+			if ev.Err != nil {
+				fmt.Printf("[工具 %s 执行失败: %v]\n", ev.ToolCall.Function.Name, ev.Err)
+			} else {
+				fmt.Printf("[工具 %s 执行完成]\n", ev.ToolCall.Function.Name)
+			}
+			atLineStart = true
+		}
+	})
+	if err != nil {
+		if !atLineStart {
+			fmt.Println()
+		}
+		printChatError(err)
+		return
+	}
+
+	fmt.Print("\n\n")
 }
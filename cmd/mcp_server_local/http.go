@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+)
+
+// Streamable HTTP 传输使用的请求头
+const (
+	headerSessionID       = "Mcp-Session-Id"
+	headerProtocolVersion = "MCP-Protocol-Version"
+)
+
+const (
+	maxRequestBytes    = 4 << 20          // 单个请求体的大小上限
+	sessionIdleTimeout = 30 * time.Minute // 会话空闲超过该时间后被清理
+	shutdownTimeout    = 10 * time.Second // 优雅关闭时等待进行中请求完成的最长时间
+)
+
+// httpSession 是一个客户端会话的状态，由 initialize 请求创建，DELETE 请求或空闲超时结束
+type httpSession struct {
+	protocolVersion string // 握手协商出的协议版本
+	lastSeen        time.Time
+}
+
+// httpServer 通过 MCP Streamable HTTP 传输对外提供 Server 中的工具，支持多个客户端同时连接
+// 本服务器不主动向客户端推送消息，每个请求都以 JSON 直接响应，不使用 SSE
+type httpServer struct {
+	srv *Server
+
+	mu       sync.Mutex
+	sessions map[string]*httpSession
+}
+
+// newHTTPServer 创建一个 HTTP 服务器，工具调用交给 srv 处理
+func newHTTPServer(srv *Server) *httpServer {
+	return &httpServer{
+		srv:      srv,
+		sessions: make(map[string]*httpSession),
+	}
+}
+
+// serveHTTP 在 addr 上提供 /mcp 与 /healthz，收到 SIGINT/SIGTERM 后停止接受新连接并等待进行中的请求完成
+func serveHTTP(srv *Server, addr string) error {
+	h := newHTTPServer(srv)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           h.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go h.expireSessions(ctx)
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("MCP server listening on %s (endpoint /mcp)", addr)
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down gracefully: %w", err)
+	}
+	return nil
+}
+
+// handler 返回提供 /mcp 与 /healthz 的路由
+func (h *httpServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mcp", h.handleMCP)
+	mux.HandleFunc("/healthz", h.handleHealthz)
+	return mux
+}
+
+// handleHealthz 用于存活检查，返回当前的会话数
+func (h *httpServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	sessions := len(h.sessions)
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "ok",
+		"sessions": sessions,
+	})
+}
+
+// handleMCP 是 MCP 端点：POST 发送 JSON-RPC 消息，DELETE 结束会话
+// 本服务器不提供服务器主动推送的 SSE 流，因此 GET 返回 405
+func (h *httpServer) handleMCP(w http.ResponseWriter, r *http.Request) {
+	if !allowedOrigin(r) {
+		http.Error(w, "forbidden origin", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		h.handlePost(w, r)
+	case http.MethodDelete:
+		h.handleDelete(w, r)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePost 处理一条 JSON-RPC 消息：initialize 请求创建新会话，其余消息必须携带有效的会话 ID
+func (h *httpServer) handlePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes+1))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxRequestBytes {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var msg protocol.JSONRPCMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		// 解析错误由 HandleRequest 生成标准的 JSON-RPC 错误响应
+		resp, _ := h.srv.HandleRequest(body)
+		writeJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	if msg.IsRequest() && msg.Method == protocol.MethodInitialize {
+		h.handleInitialize(w, body)
+		return
+	}
+
+	sessionID := r.Header.Get(headerSessionID)
+	if sessionID == "" {
+		http.Error(w, "missing "+headerSessionID+" header", http.StatusBadRequest)
+		return
+	}
+	session, ok := h.touchSession(sessionID)
+	if !ok {
+		// 404 让客户端知道需要重新握手
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	// 客户端应在握手后的每个请求中携带协商出的版本；旧版客户端可能不携带，此时不做检查
+	if version := r.Header.Get(headerProtocolVersion); version != "" && version != session.protocolVersion {
+		http.Error(w, "unsupported protocol version: "+version, http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.srv.HandleRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if resp == nil {
+		// 通知与客户端发来的响应不需要回复
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleInitialize 完成握手并创建新会话，会话 ID 通过响应头返回
+func (h *httpServer) handleInitialize(w http.ResponseWriter, body []byte) {
+	resp, err := h.srv.HandleRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var result struct {
+		Result *protocol.InitializeResult `json:"result"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil || result.Result == nil {
+		// 握手失败（例如参数错误），不创建会话
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	sessionID, err := newSessionID()
+	if err != nil {
+		http.Error(w, "failed to create session", http.StatusInternalServerError)
+		return
+	}
+	h.mu.Lock()
+	h.sessions[sessionID] = &httpSession{
+		protocolVersion: result.Result.ProtocolVersion,
+		lastSeen:        time.Now(),
+	}
+	h.mu.Unlock()
+
+	w.Header().Set(headerSessionID, sessionID)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleDelete 结束客户端的会话
+func (h *httpServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get(headerSessionID)
+	h.mu.Lock()
+	_, ok := h.sessions[sessionID]
+	delete(h.sessions, sessionID)
+	h.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// touchSession 查找会话并更新其最近活动时间，返回会话状态的副本
+func (h *httpServer) touchSession(sessionID string) (httpSession, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.sessions[sessionID]
+	if !ok {
+		return httpSession{}, false
+	}
+	s.lastSeen = time.Now()
+	return *s, true
+}
+
+// expireSessions 定期清理空闲超时的会话，直到 ctx 被取消
+func (h *httpServer) expireSessions(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		h.mu.Lock()
+		for id, s := range h.sessions {
+			if time.Since(s.lastSeen) > sessionIdleTimeout {
+				delete(h.sessions, id)
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// newSessionID 生成一个随机的会话 ID
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// allowedOrigin 校验浏览器请求的 Origin，防止 DNS 重绑定攻击：
+// 没有 Origin 的请求（非浏览器客户端）放行，否则 Origin 必须与 Host 相同或为本机地址
+func allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if u.Host == r.Host {
+		return true
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+// writeJSON 以指定状态码写回 JSON 响应体
+func writeJSON(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+)
+
+func newTestHTTPServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(newHTTPServer(NewServer()).handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// send 向 /mcp 发送一个请求，返回状态码、响应头与响应体
+func send(t *testing.T, srv *httptest.Server, method, session, body string, header map[string]string) (int, http.Header, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+"/mcp", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if session != "" {
+		req.Header.Set(headerSessionID, session)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header, string(data)
+}
+
+// initialize 完成握手并返回新会话的 ID
+func initialize(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	status, header, body := send(t, srv, http.MethodPost, "",
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`, nil)
+	if status != http.StatusOK {
+		t.Fatalf("initialize status = %d: %s", status, body)
+	}
+	session := header.Get(headerSessionID)
+	if session == "" {
+		t.Fatalf("initialize returned no %s header", headerSessionID)
+	}
+	return session
+}
+
+// decodeResponse 解析 JSON-RPC 响应
+func decodeResponse(t *testing.T, body string) protocol.JSONRPCMessage {
+	t.Helper()
+	var msg protocol.JSONRPCMessage
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		t.Fatalf("invalid response %q: %v", body, err)
+	}
+	return msg
+}
+
+func TestHTTPSessionLifecycle(t *testing.T) {
+	srv := newTestHTTPServer(t)
+	session := initialize(t, srv)
+
+	status, _, body := send(t, srv, http.MethodPost, session, `{"jsonrpc":"2.0","method":"notifications/initialized"}`, nil)
+	if status != http.StatusAccepted || body != "" {
+		t.Errorf("notification: status = %d, body = %q; want 202 with no body", status, body)
+	}
+
+	status, _, body = send(t, srv, http.MethodPost, session, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		map[string]string{headerProtocolVersion: "2025-06-18"})
+	if status != http.StatusOK {
+		t.Fatalf("tools/list status = %d: %s", status, body)
+	}
+	var result protocol.ListToolsResult
+	if msg := decodeResponse(t, body); msg.Error != nil || json.Unmarshal(msg.Result, &result) != nil || len(result.Tools) == 0 {
+		t.Fatalf("tools/list returned %s", body)
+	}
+
+	status, _, _ = send(t, srv, http.MethodDelete, session, "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("DELETE status = %d, want 200", status)
+	}
+	status, _, _ = send(t, srv, http.MethodPost, session, `{"jsonrpc":"2.0","id":3,"method":"ping"}`, nil)
+	if status != http.StatusNotFound {
+		t.Errorf("request on deleted session: status = %d, want 404", status)
+	}
+	status, _, _ = send(t, srv, http.MethodDelete, session, "", nil)
+	if status != http.StatusNotFound {
+		t.Errorf("second DELETE: status = %d, want 404", status)
+	}
+}
+
+func TestHTTPRejectsInvalidRequests(t *testing.T) {
+	srv := newTestHTTPServer(t)
+	session := initialize(t, srv)
+
+	tests := []struct {
+		name    string
+		method  string
+		session string
+		body    string
+		header  map[string]string
+		status  int
+	}{
+		{"unknown session", http.MethodPost, "no-such-session", `{"jsonrpc":"2.0","id":1,"method":"ping"}`, nil, http.StatusNotFound},
+		{"missing session", http.MethodPost, "", `{"jsonrpc":"2.0","id":1,"method":"ping"}`, nil, http.StatusBadRequest},
+		{"protocol version mismatch", http.MethodPost, session, `{"jsonrpc":"2.0","id":1,"method":"ping"}`,
+			map[string]string{headerProtocolVersion: "2024-11-05"}, http.StatusBadRequest},
+		{"malformed json", http.MethodPost, session, `{"jsonrpc":`, nil, http.StatusBadRequest},
+		{"GET stream", http.MethodGet, session, "", nil, http.StatusMethodNotAllowed},
+		{"foreign origin", http.MethodPost, session, `{"jsonrpc":"2.0","id":1,"method":"ping"}`,
+			map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"invalid origin", http.MethodPost, session, `{"jsonrpc":"2.0","id":1,"method":"ping"}`,
+			map[string]string{"Origin": "http://[::1"}, http.StatusForbidden},
+		{"localhost origin", http.MethodPost, session, `{"jsonrpc":"2.0","id":1,"method":"ping"}`,
+			map[string]string{"Origin": "http://localhost:3000"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := send(t, srv, tt.method, tt.session, tt.body, tt.header)
+			if status != tt.status {
+				t.Errorf("status = %d, want %d: %s", status, tt.status, body)
+			}
+		})
+	}
+}
+
+func TestHTTPParseErrorIsJSONRPC(t *testing.T) {
+	srv := newTestHTTPServer(t)
+	status, _, body := send(t, srv, http.MethodPost, "", `{not json`, nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", status)
+	}
+	if msg := decodeResponse(t, body); msg.Error == nil || msg.Error.Code != protocol.CodeParseError {
+		t.Errorf("response = %s, want a %d error", body, protocol.CodeParseError)
+	}
+}
+
+func TestHTTPHealthzCountsSessions(t *testing.T) {
+	srv := newTestHTTPServer(t)
+	sessions := func() int {
+		resp, err := srv.Client().Get(srv.URL + "/healthz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var health struct {
+			Status   string `json:"status"`
+			Sessions int    `json:"sessions"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&health); err != nil || health.Status != "ok" {
+			t.Fatalf("healthz returned %+v, %v", health, err)
+		}
+		return health.Sessions
+	}
+
+	if n := sessions(); n != 0 {
+		t.Errorf("sessions = %d before any client, want 0", n)
+	}
+	first := initialize(t, srv)
+	initialize(t, srv)
+	if n := sessions(); n != 2 {
+		t.Errorf("sessions = %d, want 2", n)
+	}
+	send(t, srv, http.MethodDelete, first, "", nil)
+	if n := sessions(); n != 1 {
+		t.Errorf("sessions = %d after DELETE, want 1", n)
+	}
+}
+
+func TestHTTPConcurrentSessions(t *testing.T) {
+	srv := newTestHTTPServer(t)
+
+	const clients, requests = 8, 20
+	sessions := make([]string, clients)
+	seen := make(map[string]bool)
+	for c := range sessions {
+		sessions[c] = initialize(t, srv)
+		if seen[sessions[c]] {
+			t.Fatalf("session ID %s handed out twice", sessions[c])
+		}
+		seen[sessions[c]] = true
+	}
+
+	var wg sync.WaitGroup
+	for c, session := range sessions {
+		wg.Add(1)
+		go func(c int, session string) {
+			defer wg.Done()
+			for i := 0; i < requests; i++ {
+				id := fmt.Sprintf(`"client-%d-%d"`, c, i)
+				if err := ping(srv, session, id); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(c, session)
+	}
+	wg.Wait()
+}
+
+// ping 在会话 session 上发送 ID 为 id 的 ping 请求，并检查响应对应该请求
+func ping(srv *httptest.Server, session, id string) error {
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":`+id+`,"method":"ping"}`))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(headerSessionID, session)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var msg protocol.JSONRPCMessage
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return fmt.Errorf("ping %s: status %d, invalid response: %v", id, resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || string(msg.ID) != id || msg.Error != nil {
+		return fmt.Errorf("ping %s: status %d, response id %s, error %v", id, resp.StatusCode, msg.ID, msg.Error)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// 旧版自定义协议（{"method":"list_tools"} / {"method":"call_tool"}），通过 --legacy 启用
+
+// HandleLegacyRequest 处理一个旧版自定义协议的请求，并返回原始的 JSON 响应字节
+// 对于不需要响应的消息（如 cancel）返回 nil
+func (s *Server) HandleLegacyRequest(requestBytes []byte) ([]byte, error) {
+	// 先解析 JSON，确定请求的方法类型
+	var rawReq map[string]interface{}
+	if err := json.Unmarshal(requestBytes, &rawReq); err != nil {
+		return s.createLegacyErrorResponse(fmt.Sprintf("invalid JSON: %v", err))
+	}
+
+	method, ok := rawReq["method"].(string)
+	if !ok {
+		return s.createLegacyErrorResponse("missing or invalid method field")
+	}
+
+	switch method {
+	case protocol.MCPMethodListTools:
+		return s.handleLegacyListTools()
+	case protocol.MCPMethodCallTool:
+		// 对于 call_tool 请求，需要工具名称和参数
+		name, ok := rawReq["name"].(string)
+		if !ok {
+			return s.createLegacyErrorResponse("missing or invalid name field for call_tool")
+		}
+
+		// 提取参数字段
+		argsRaw, exists := rawReq["arguments"]
+		if !exists {
+			// 如果没有提供 arguments，默认使用空对象
+			argsRaw = map[string]interface{}{}
+		}
+
+		argsMap, ok := argsRaw.(map[string]interface{})
+		if !ok {
+			return s.createLegacyErrorResponse("arguments must be an object")
+		}
+
+		// 转换为工具所需的参数类型
+		args := tools.ToolArguments(argsMap)
+
+		return s.handleLegacyCallTool(name, args)
+	case protocol.MCPMethodCancel:
+		// 请求按顺序处理，收到取消时被取消的请求已经完成；取消消息本身不需要响应
+		return nil, nil
+	default:
+		return s.createLegacyErrorResponse(fmt.Sprintf("unknown method: %s", method))
+	}
+}
+
+// handleLegacyListTools 返回当前服务器支持的所有工具列表
+func (s *Server) handleLegacyListTools() ([]byte, error) {
+	defs := s.reg.ListAll()
+
+	// 构造工具定义列表，注意：Function 字段不能被序列化（会变成 null）
+	toolDefs := make([]tools.ToolDefinition, len(defs))
+	for i, def := range defs {
+		toolDefs[i] = tools.ToolDefinition{
+			Name:        def.Name,
+			Description: def.Description,
+			Parameters:  def.Parameters,
+			// Function 字段留空，因为 JSON 序列化时会忽略它（标记为 `json:"-"`）
+		}
+	}
+
+	response := protocol.MCPListToolsResponse{
+		Tools: toolDefs,
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		return s.createLegacyErrorResponse(fmt.Sprintf("failed to marshal list_tools response: %v", err))
+	}
+
+	return jsonBytes, nil
+}
+
+// handleLegacyCallTool 执行指定名称的工具，并传入给定的参数
+func (s *Server) handleLegacyCallTool(name string, args tools.ToolArguments) ([]byte, error) {
+	if name == "" {
+		return s.createLegacyErrorResponse("tool name is required")
+	}
+
+	def, ok := s.reg.Get(name)
+	if !ok {
+		return s.createLegacyErrorResponse(fmt.Sprintf("tool not found: %s", name))
+	}
+
+	// 与 tools/call 一致，先按 schema 校验参数；旧版协议没有 isError，问题列表放在 error 字段中返回
+	args, err := def.Parameters.Validate(args)
+	if err != nil {
+		return s.createLegacyErrorResponse(err.Error())
+	}
+
+	result, err := def.Function(args)
+	if err != nil {
+		return s.createLegacyErrorResponse(fmt.Sprintf("tool execution failed: %v", err))
+	}
+
+	response := protocol.MCPToolCallResponse{
+		Result: result,
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		return s.createLegacyErrorResponse(fmt.Sprintf("failed to marshal call_tool response: %v", err))
+	}
+
+	return jsonBytes, nil
+}
+
+// createLegacyErrorResponse 生成一个符合协议格式的错误响应
+func (s *Server) createLegacyErrorResponse(message string) ([]byte, error) {
+	errorResponse := protocol.MCPToolCallResponse{
+		Error:  message,
+		Result: "", // 出错时确保 result 字段为空
+	}
+
+	jsonBytes, err := json.Marshal(errorResponse)
+	if err != nil {
+		// 理论上这个简单的结构不会序列化失败
+		// 但万一失败了，就返回一个最基本的错误 JSON
+		fallback := `{"error": "failed to create error response"}`
+		return []byte(fallback), nil
+	}
+
+	return jsonBytes, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// newLegacyTestServer 创建注册了一个带参数工具的服务器，called 记录工具是否被执行以及收到的参数
+func newLegacyTestServer(called *tools.ToolArguments) *Server {
+	s := NewServer()
+	s.reg.Register(tools.ToolDefinition{
+		Name: "repeat",
+		Parameters: tools.Schema{
+			Type: tools.SchemaType{"object"},
+			Properties: map[string]*tools.Schema{
+				"text":  {Type: tools.SchemaType{"string"}},
+				"times": {Type: tools.SchemaType{"integer"}},
+			},
+			Required: []string{"text", "times"},
+		},
+		Function: func(args tools.ToolArguments) (string, error) {
+			*called = args
+			return strings.Repeat(args["text"].(string), int(args["times"].(float64))), nil
+		},
+	})
+	return s
+}
+
+func callLegacy(t *testing.T, s *Server, request string) protocol.MCPToolCallResponse {
+	t.Helper()
+	raw, err := s.HandleLegacyRequest([]byte(request))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp protocol.MCPToolCallResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		t.Fatalf("invalid response %s: %v", raw, err)
+	}
+	return resp
+}
+
+func TestLegacyCallToolValidatesArguments(t *testing.T) {
+	var called tools.ToolArguments
+	s := newLegacyTestServer(&called)
+
+	resp := callLegacy(t, s, `{"method":"call_tool","name":"repeat","arguments":{"times":"abc"}}`)
+	if called != nil {
+		t.Fatal("tool ran with invalid arguments")
+	}
+	if resp.Result != "" {
+		t.Errorf("result = %q, want empty", resp.Result)
+	}
+	for _, want := range []string{tools.ErrInvalidArguments.Error(), "text", "times"} {
+		if !strings.Contains(resp.Error, want) {
+			t.Errorf("error %q does not mention %q", resp.Error, want)
+		}
+	}
+}
+
+func TestLegacyCallToolPassesCoercedArguments(t *testing.T) {
+	var called tools.ToolArguments
+	s := newLegacyTestServer(&called)
+
+	// 字符串形式的数字按 schema 转换后再交给工具
+	resp := callLegacy(t, s, `{"method":"call_tool","name":"repeat","arguments":{"text":"ab","times":"3"}}`)
+	if resp.Error != "" || resp.Result != "ababab" {
+		t.Fatalf("got %+v", resp)
+	}
+	if _, ok := called["times"].(float64); !ok {
+		t.Fatalf("times = %#v, want the coerced number", called["times"])
+	}
+}
@@ -2,42 +2,100 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"sync"
 )
 
 // 启动 MCP 本地服务器，从标准输入逐行读取请求，处理后将响应写回标准输出
+// 默认使用 MCP（JSON-RPC 2.0）协议，每个请求在单独的 goroutine 中处理，响应按完成顺序写回；
+// --legacy 切换为旧版自定义协议，由于没有请求 ID，请求按顺序逐个处理；
+// --http 改为在指定地址上通过 Streamable HTTP 提供服务，供多个客户端共享
 func main() {
+	legacy := flag.Bool("legacy", false, "use the legacy list_tools/call_tool protocol instead of MCP JSON-RPC")
+	httpAddr := flag.String("http", "", "serve MCP over Streamable HTTP on this address (e.g. :8080) instead of stdio")
+	flag.Parse()
+
 	srv := NewServer()
 
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		line := scanner.Bytes()
+	if *httpAddr != "" {
+		if *legacy {
+			fmt.Fprintln(os.Stderr, "--legacy cannot be combined with --http")
+			os.Exit(2)
+		}
+		if err := serveHTTP(srv, *httpAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "HTTP server error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := serveStdio(srv, os.Stdin, os.Stdout, *legacy); err != nil {
+		fmt.Fprintf(os.Stderr, "Read error: %v\n", err)
+		os.Exit(1)
+	}
+}
 
-		respBytes, err := srv.HandleRequest(line)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
+// serveStdio 从 in 逐行读取请求，处理后将响应写入 w，直到 in 结束并且所有请求都已写回响应
+// MCP 模式下每个请求在单独的 goroutine 中处理，响应按完成顺序写回；legacy 模式下请求按顺序逐个处理
+func serveStdio(srv *Server, in io.Reader, w io.Writer, legacy bool) error {
+	out := &responseWriter{w: w}
+
+	var wg sync.WaitGroup
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
 			continue
 		}
 
-		_, err = os.Stdout.Write(respBytes)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Write error: %v\n", err)
-			os.Exit(1)
+		if legacy {
+			out.handle(srv.HandleLegacyRequest, scanner.Bytes())
+			continue
 		}
 
-		// 添加换行符以符合 NDJSON 格式（每条 JSON 单独一行）
-		_, err = os.Stdout.WriteString("\n")
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Write error: %v\n", err)
-			os.Exit(1)
-		}
+		// scanner 会复用缓冲区，交给 goroutine 前先复制
+		line := make([]byte, len(scanner.Bytes()))
+		copy(line, scanner.Bytes())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out.handle(srv.HandleRequest, line)
+		}()
 	}
 
-	// 检查是否因非 EOF 原因导致读取失败
-	if err := scanner.Err(); err != nil && err != io.EOF {
-		fmt.Fprintf(os.Stderr, "Read error: %v\n", err)
+	// 等待仍在处理的请求写回响应
+	wg.Wait()
+
+	// scanner 在 EOF 时不返回错误，这里只有真正的读取失败
+	return scanner.Err()
+}
+
+// responseWriter 串行化多个 goroutine 对标准输出的写入，保证每条响应独占一行
+type responseWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// handle 处理一条请求并写回响应；不需要响应的消息不写任何内容
+func (o *responseWriter) handle(handler func([]byte) ([]byte, error), line []byte) {
+	respBytes, err := handler(line)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
+		return
+	}
+	if respBytes == nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// 添加换行符以符合 NDJSON 格式（每条 JSON 单独一行），一次写入避免与其他响应交错
+	if _, err := o.w.Write(append(respBytes, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "Write error: %v\n", err)
 		os.Exit(1)
 	}
 }
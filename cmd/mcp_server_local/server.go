@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/windlant/mcp-client/internal/protocol"
 	"github.com/windlant/mcp-client/internal/tools"
@@ -10,6 +11,9 @@ import (
 	"github.com/windlant/mcp-client/internal/tools/manage/registry"
 )
 
+// serverInfo 是本服务器在 initialize 握手中上报的实现信息
+var serverInfo = protocol.Implementation{Name: "mcp-server-local", Version: "0.1.0"}
+
 // Server 用于处理 MCP 请求
 type Server struct {
 	reg *registry.Registry
@@ -28,119 +32,160 @@ func NewServer() *Server {
 	}
 }
 
-// HandleRequest 处理一个 MCP 请求，并返回原始的 JSON 响应字节
+// HandleRequest 处理一条 MCP（JSON-RPC 2.0）消息，并返回原始的 JSON 响应字节
+// 对于不需要响应的消息（通知、客户端发来的响应）返回 nil
 func (s *Server) HandleRequest(requestBytes []byte) ([]byte, error) {
-	// 先解析 JSON，确定请求的方法类型
-	var rawReq map[string]interface{}
-	if err := json.Unmarshal(requestBytes, &rawReq); err != nil {
-		return s.createErrorResponse(fmt.Sprintf("invalid JSON: %v", err))
+	if !json.Valid(requestBytes) {
+		return s.createErrorResponse(protocol.NullID, protocol.CodeParseError, "parse error")
 	}
 
-	method, ok := rawReq["method"].(string)
-	if !ok {
-		return s.createErrorResponse("missing or invalid method field")
+	var msg protocol.JSONRPCMessage
+	if err := json.Unmarshal(requestBytes, &msg); err != nil {
+		return s.createErrorResponse(protocol.NullID, protocol.CodeInvalidRequest, fmt.Sprintf("invalid request: %v", err))
+	}
+	if msg.JSONRPC != protocol.JSONRPCVersion {
+		return s.createErrorResponse(msg.ID, protocol.CodeInvalidRequest, "invalid request: jsonrpc must be \"2.0\"")
 	}
 
-	switch method {
-	case protocol.MCPMethodListTools:
-		return s.handleListTools()
-	case protocol.MCPMethodCallTool:
-		// 对于 call_tool 请求，需要工具名称和参数
-		name, ok := rawReq["name"].(string)
-		if !ok {
-			return s.createErrorResponse("missing or invalid name field for call_tool")
-		}
-
-		// 提取参数字段
-		argsRaw, exists := rawReq["arguments"]
-		if !exists {
-			// 如果没有提供 arguments，默认使用空对象
-			argsRaw = map[string]interface{}{}
-		}
+	switch {
+	case msg.IsNotification():
+		// initialized、cancelled 等通知不需要响应；工具函数无法中途停止，被取消请求的响应由客户端丢弃
+		return nil, nil
+	case msg.IsResponse():
+		// 服务器不向客户端发起请求，收到的响应直接忽略
+		return nil, nil
+	case !msg.IsRequest():
+		return s.createErrorResponse(msg.ID, protocol.CodeInvalidRequest, "invalid request: missing method")
+	}
 
-		argsMap, ok := argsRaw.(map[string]interface{})
-		if !ok {
-			return s.createErrorResponse("arguments must be an object")
-		}
+	switch msg.Method {
+	case protocol.MethodInitialize:
+		return s.handleInitialize(msg.ID, msg.Params)
+	case protocol.MethodPing:
+		return s.createResponse(msg.ID, struct{}{})
+	case protocol.MethodToolsList:
+		return s.handleListTools(msg.ID)
+	case protocol.MethodToolsCall:
+		return s.handleCallTool(msg.ID, msg.Params)
+	default:
+		return s.createErrorResponse(msg.ID, protocol.CodeMethodNotFound, fmt.Sprintf("method not found: %s", msg.Method))
+	}
+}
 
-		// 转换为工具所需的参数类型
-		args := tools.ToolArguments(argsMap)
+// handleInitialize 完成握手：客户端请求的协议版本受支持时沿用该版本，否则返回我们支持的最新版本
+func (s *Server) handleInitialize(id json.RawMessage, rawParams json.RawMessage) ([]byte, error) {
+	var params protocol.InitializeParams
+	if err := unmarshalParams(rawParams, &params); err != nil {
+		return s.createErrorResponse(id, protocol.CodeInvalidParams, fmt.Sprintf("invalid initialize params: %v", err))
+	}
 
-		return s.handleCallTool(name, args)
-	default:
-		return s.createErrorResponse(fmt.Sprintf("unknown method: %s", method))
+	version := params.ProtocolVersion
+	if !protocol.IsSupportedProtocolVersion(version) {
+		version = protocol.LatestProtocolVersion
 	}
+
+	return s.createResponse(id, protocol.InitializeResult{
+		ProtocolVersion: version,
+		Capabilities: protocol.ServerCapabilities{
+			Tools: &protocol.ToolsCapability{},
+		},
+		ServerInfo: serverInfo,
+	})
 }
 
-// handleListTools 返回当前服务器支持的所有工具列表
-func (s *Server) handleListTools() ([]byte, error) {
+// handleListTools 返回当前服务器支持的所有工具列表（按名称排序）
+func (s *Server) handleListTools(id json.RawMessage) ([]byte, error) {
 	defs := s.reg.ListAll()
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
 
-	// 构造工具定义列表，注意：Function 字段不能被序列化（会变成 null）
-	toolDefs := make([]tools.ToolDefinition, len(defs))
+	result := protocol.ListToolsResult{
+		Tools: make([]protocol.Tool, len(defs)),
+	}
 	for i, def := range defs {
-		toolDefs[i] = tools.ToolDefinition{
+		schema := def.Parameters
+		// 部分客户端不接受 null 的 properties/required，统一输出空值
+		if schema.Type == nil {
+			schema.Type = tools.SchemaType{"object"}
+		}
+		if schema.Properties == nil {
+			schema.Properties = map[string]*tools.Schema{}
+		}
+		if schema.Required == nil {
+			schema.Required = []string{}
+		}
+		result.Tools[i] = protocol.Tool{
 			Name:        def.Name,
 			Description: def.Description,
-			Parameters:  def.Parameters,
-			// Function 字段留空，因为 JSON 序列化时会忽略它（标记为 `json:"-"`）
+			InputSchema: schema,
+			Annotations: protocol.AnnotationsFor(def),
 		}
 	}
 
-	response := protocol.MCPListToolsResponse{
-		Tools: toolDefs,
-	}
-
-	jsonBytes, err := json.Marshal(response)
-	if err != nil {
-		return s.createErrorResponse(fmt.Sprintf("failed to marshal list_tools response: %v", err))
-	}
-
-	return jsonBytes, nil
+	return s.createResponse(id, result)
 }
 
-// handleCallTool 执行指定名称的工具，并传入给定的参数
-func (s *Server) handleCallTool(name string, args tools.ToolArguments) ([]byte, error) {
-	if name == "" {
-		return s.createErrorResponse("tool name is required")
+// handleCallTool 执行指定名称的工具；工具执行失败通过 isError 结果返回给模型，而不是 JSON-RPC 错误
+func (s *Server) handleCallTool(id json.RawMessage, rawParams json.RawMessage) ([]byte, error) {
+	var params protocol.CallToolParams
+	if err := unmarshalParams(rawParams, &params); err != nil {
+		return s.createErrorResponse(id, protocol.CodeInvalidParams, fmt.Sprintf("invalid tools/call params: %v", err))
+	}
+	if params.Name == "" {
+		return s.createErrorResponse(id, protocol.CodeInvalidParams, "tool name is required")
 	}
 
-	def, ok := s.reg.Get(name)
+	def, ok := s.reg.Get(params.Name)
 	if !ok {
-		return s.createErrorResponse(fmt.Sprintf("tool not found: %s", name))
+		return s.createErrorResponse(id, protocol.CodeInvalidParams, fmt.Sprintf("unknown tool: %s", params.Name))
+	}
+
+	// 参数不符合 schema 时按工具执行错误返回（isError），让模型看到逐项的问题并修正后重试
+	args, err := def.Parameters.Validate(tools.ToolArguments(params.Arguments))
+	if err != nil {
+		return s.createResponse(id, protocol.CallToolResult{
+			Content: []protocol.Content{protocol.TextContent(err.Error())},
+			IsError: true,
+		})
 	}
 
 	result, err := def.Function(args)
 	if err != nil {
-		return s.createErrorResponse(fmt.Sprintf("tool execution failed: %v", err))
+		return s.createResponse(id, protocol.CallToolResult{
+			Content: []protocol.Content{protocol.TextContent(fmt.Sprintf("tool execution failed: %v", err))},
+			IsError: true,
+		})
 	}
 
-	response := protocol.MCPToolCallResponse{
-		Result: result,
+	return s.createResponse(id, protocol.CallToolResult{
+		Content: []protocol.Content{protocol.TextContent(result)},
+	})
+}
+
+// unmarshalParams 解析请求参数，缺省的 params 视为空对象
+func unmarshalParams(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
 	}
+	return json.Unmarshal(raw, v)
+}
 
-	jsonBytes, err := json.Marshal(response)
+// createResponse 生成一个 JSON-RPC 成功响应
+func (s *Server) createResponse(id json.RawMessage, result interface{}) ([]byte, error) {
+	jsonBytes, err := json.Marshal(protocol.NewResult(id, result))
 	if err != nil {
-		return s.createErrorResponse(fmt.Sprintf("failed to marshal call_tool response: %v", err))
+		return s.createErrorResponse(id, protocol.CodeInternalError, fmt.Sprintf("failed to marshal response: %v", err))
 	}
-
 	return jsonBytes, nil
 }
 
-// createErrorResponse 生成一个符合协议格式的错误响应
-func (s *Server) createErrorResponse(message string) ([]byte, error) {
-	errorResponse := protocol.MCPToolCallResponse{
-		Error:  message,
-		Result: "", // 出错时确保 result 字段为空
-	}
-
-	jsonBytes, err := json.Marshal(errorResponse)
+// createErrorResponse 生成一个 JSON-RPC 错误响应
+func (s *Server) createErrorResponse(id json.RawMessage, code int, message string) ([]byte, error) {
+	jsonBytes, err := json.Marshal(protocol.NewErrorResponse(id, code, message))
 	if err != nil {
 		// 理论上这个简单的结构不会序列化失败
 		// 但万一失败了，就返回一个最基本的错误 JSON
-		fallback := `{"error": "failed to create error response"}`
+		fallback := fmt.Sprintf(`{"jsonrpc":"2.0","id":null,"error":{"code":%d,"message":"failed to create error response"}}`, protocol.CodeInternalError)
 		return []byte(fallback), nil
 	}
-
 	return jsonBytes, nil
 }
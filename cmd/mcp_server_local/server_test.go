@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+func TestHandleRequestErrorCodes(t *testing.T) {
+	s := NewServer()
+
+	tests := []struct {
+		name    string
+		request string
+		id      string
+		code    int
+	}{
+		{"invalid json", `{"jsonrpc":"2.0","id":1,`, "null", protocol.CodeParseError},
+		{"not an object", `[1,2,3]`, "null", protocol.CodeInvalidRequest},
+		{"wrong jsonrpc version", `{"jsonrpc":"1.0","id":1,"method":"ping"}`, "1", protocol.CodeInvalidRequest},
+		{"missing jsonrpc version", `{"id":1,"method":"ping"}`, "1", protocol.CodeInvalidRequest},
+		{"missing method", `{"jsonrpc":"2.0","id":1,"params":{}}`, "1", protocol.CodeInvalidRequest},
+		{"unknown method", `{"jsonrpc":"2.0","id":"a","method":"resources/list"}`, `"a"`, protocol.CodeMethodNotFound},
+		{"bad initialize params", `{"jsonrpc":"2.0","id":2,"method":"initialize","params":"2025-06-18"}`, "2", protocol.CodeInvalidParams},
+		{"bad tools/call params", `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":[1]}`, "3", protocol.CodeInvalidParams},
+		{"missing tool name", `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"arguments":{}}}`, "4", protocol.CodeInvalidParams},
+		{"unknown tool", `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"no_such_tool"}}`, "5", protocol.CodeInvalidParams},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := s.HandleRequest([]byte(tt.request))
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := decodeResponse(t, string(raw))
+			if msg.Error == nil || msg.Error.Code != tt.code {
+				t.Fatalf("response = %s, want a %d error", raw, tt.code)
+			}
+			if string(msg.ID) != tt.id || msg.JSONRPC != protocol.JSONRPCVersion || msg.Result != nil {
+				t.Errorf("response = %s, want a 2.0 error response with id %s", raw, tt.id)
+			}
+		})
+	}
+}
+
+func TestHandleRequestIgnoresNotificationsAndResponses(t *testing.T) {
+	s := NewServer()
+
+	for _, msg := range []string{
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1}}`,
+		`{"jsonrpc":"2.0","method":"no/such/notification"}`,
+		`{"jsonrpc":"2.0","id":7,"result":{}}`,
+		`{"jsonrpc":"2.0","id":8,"error":{"code":-32601,"message":"method not found"}}`,
+	} {
+		raw, err := s.HandleRequest([]byte(msg))
+		if err != nil || raw != nil {
+			t.Errorf("%s: got %s, %v; want no response", msg, raw, err)
+		}
+	}
+}
+
+func TestServeStdioMatchesConcurrentResponses(t *testing.T) {
+	s := NewServer()
+	s.reg.Register(tools.ToolDefinition{
+		Name: "sleep",
+		Parameters: tools.Schema{
+			Type: tools.SchemaType{"object"},
+			Properties: map[string]*tools.Schema{
+				"ms":    {Type: tools.SchemaType{"integer"}},
+				"reply": {Type: tools.SchemaType{"string"}},
+			},
+			Required: []string{"ms", "reply"},
+		},
+		Function: func(args tools.ToolArguments) (string, error) {
+			time.Sleep(time.Duration(args["ms"].(float64)) * time.Millisecond)
+			return args["reply"].(string), nil
+		},
+	})
+
+	// 先发出的请求耗时更长，响应顺序与请求顺序不同；通知穿插其中且不应产生响应
+	const n = 30
+	var in strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&in, `{"jsonrpc":"2.0","id":"req-%d","method":"tools/call","params":{"name":"sleep","arguments":{"ms":%d,"reply":"reply-%d"}}}`+"\n",
+			i, (n-i)*2, i)
+		if i%5 == 0 {
+			in.WriteString(`{"jsonrpc":"2.0","method":"notifications/progress","params":{}}` + "\n\n")
+		}
+	}
+
+	var out bytes.Buffer
+	if err := serveStdio(s, strings.NewReader(in.String()), &out, false); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		msg := decodeResponse(t, scanner.Text())
+		var id string
+		if err := json.Unmarshal(msg.ID, &id); err != nil || seen[id] {
+			t.Fatalf("unexpected or repeated response id in %s", scanner.Text())
+		}
+		seen[id] = true
+
+		var result protocol.CallToolResult
+		if msg.Error != nil || json.Unmarshal(msg.Result, &result) != nil || result.IsError || len(result.Content) != 1 {
+			t.Fatalf("response = %s, want a successful tool result", scanner.Text())
+		}
+		if want := "reply-" + strings.TrimPrefix(id, "req-"); result.Content[0].Text != want {
+			t.Errorf("response %s carries %q, want %q", id, result.Content[0].Text, want)
+		}
+	}
+	if len(seen) != n {
+		t.Errorf("got %d responses, want one per request (%d)", len(seen), n)
+	}
+}
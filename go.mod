@@ -2,9 +2,9 @@ module github.com/windlant/mcp-client
 
 go 1.23.4
 
-require gopkg.in/yaml.v3 v3.0.1
-
 require (
-	github.com/chzyer/readline v1.5.1 // indirect
-	golang.org/x/sys v0.0.0-20220310020820-b874c991c1a5 // indirect
+	github.com/chzyer/readline v1.5.1
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/sys v0.0.0-20220310020820-b874c991c1a5 // indirect
@@ -1,7 +1,9 @@
 package agent
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/windlant/mcp-client/internal/model"
@@ -16,6 +18,23 @@ type Agent struct {
 	history      []protocol.Message // 对话历史记录
 	maxMessages  int                // 最大保存的历史消息数（不含 system 消息）
 	toolsEnabled bool               // 是否启用工具调用功能
+	options      *model.ChatOptions // 覆盖模型默认值的采样参数，nil 表示使用配置中的默认值
+	price        *Price             // 当前模型的价格，nil 表示不计算费用
+	turnUsage    UsageStats         // 最近一轮对话的用量
+	sessionUsage UsageStats         // 整个会话累计的用量
+
+	// 基于 token 的上下文裁剪，maxTokens 为 0 时只按消息数裁剪
+	estimator           TokenEstimator // token 估算器
+	maxTokens           int            // 模型上下文窗口大小
+	reserveTokens       int            // 为模型回复预留的 token 数
+	maxToolResultTokens int            // 单个工具结果的 token 上限，0 表示不截断
+	toolTokens          int            // 工具定义占用的 token 数，每轮获取工具列表时更新
+
+	compaction CompactionOptions // 对话压缩配置
+
+	toolExec        ToolExecOptions         // 工具调用的并发与超时配置
+	sequentialTools map[string]bool         // 不可并行执行的工具，每轮获取工具列表时更新
+	toolSchemas     map[string]tools.Schema // 各工具的输入 schema，用于在调用前校验参数，每轮获取工具列表时更新
 }
 
 // NewAgent 创建一个新的智能代理
@@ -33,47 +52,180 @@ func NewAgent(m model.Model, maxHistory int, toolsEnabled bool, toolClient tools
 		history:      make([]protocol.Message, 0),
 		maxMessages:  maxHistory,
 		toolsEnabled: toolsEnabled,
+		estimator:    ApproxTokenEstimator{},
 	}
 }
 
-// trimHistory 修剪对话历史，确保不超过最大消息数（system 消息除外）
-func (a *Agent) trimHistory() {
-	if len(a.history) == 0 {
-		return
+// SetChatOptions 设置后续请求使用的采样参数，用于让不同任务使用不同的采样策略
+// 传入 nil 表示恢复为配置中的默认值
+func (a *Agent) SetChatOptions(opts *model.ChatOptions) {
+	a.options = opts
+}
+
+// SetTokenBudget 启用基于 token 预算的历史裁剪
+// maxTokens 是模型的上下文窗口大小，为 0 时只按消息数裁剪；reserveTokens 是为模型回复预留的 token 数；
+// maxToolResultTokens 是单个工具结果允许占用的 token 上限，超出部分会被截断，为 0 时不截断
+func (a *Agent) SetTokenBudget(maxTokens, reserveTokens, maxToolResultTokens int) {
+	a.maxTokens = maxTokens
+	a.reserveTokens = reserveTokens
+	a.maxToolResultTokens = maxToolResultTokens
+}
+
+// SetTokenEstimator 替换用于估算 token 数的估算器，默认使用 ApproxTokenEstimator
+func (a *Agent) SetTokenEstimator(e TokenEstimator) {
+	if e == nil {
+		e = ApproxTokenEstimator{}
+	}
+	a.estimator = e
+}
+
+// historyTokenBudget 返回除 system 消息外的历史可以占用的 token 数，未启用 token 预算时返回 -1
+func (a *Agent) historyTokenBudget(systemMsgs []protocol.Message) int {
+	if a.maxTokens <= 0 {
+		return -1
 	}
+	budget := a.maxTokens - a.reserveTokens - a.toolTokens
+	for _, msg := range systemMsgs {
+		budget -= estimateMessageTokens(a.estimator, msg)
+	}
+	if budget < 0 {
+		budget = 0
+	}
+	return budget
+}
 
-	// 先找 system 消息的位置
-	systemIdx := -1
+// truncateToolResult 按 maxToolResultTokens 截断过大的工具结果
+func (a *Agent) truncateToolResult(result string) string {
+	return truncateToTokens(a.estimator, result, a.maxToolResultTokens)
+}
+
+// splitUnits 将非 system 消息切分为裁剪时不可拆分的单元
+// 带有 ToolCalls 的助手消息与紧随其后的所有 tool 消息组成一个单元，其余消息各自成为一个单元；
+// 开头没有对应助手消息的孤立 tool 消息会被丢弃，因为 API 会拒绝这样的历史
+func splitUnits(msgs []protocol.Message) [][]protocol.Message {
+	var units [][]protocol.Message
+	for i := 0; i < len(msgs); {
+		if msgs[i].Role == "tool" {
+			i++
+			continue
+		}
+		j := i + 1
+		if msgs[i].Role == "assistant" && len(msgs[i].ToolCalls) > 0 {
+			for j < len(msgs) && msgs[j].Role == "tool" {
+				j++
+			}
+		}
+		units = append(units, msgs[i:j])
+		i = j
+	}
+	return units
+}
+
+// splitSystem 找到第一条 system 消息及紧随其后的 system 消息（如对话摘要），
+// 返回这些固定保留的消息（可能为空）与其后的其余消息
+func (a *Agent) splitSystem() ([]protocol.Message, []protocol.Message) {
 	for i, msg := range a.history {
 		if msg.Role == "system" {
-			systemIdx = i
-			break
+			j := i + 1
+			for j < len(a.history) && a.history[j].Role == "system" {
+				j++
+			}
+			return a.history[i:j], a.history[j:]
 		}
 	}
+	return nil, a.history
+}
 
-	// 分离出非 system 的消息
-	nonSystemMsgs := a.history
-	if systemIdx >= 0 {
-		nonSystemMsgs = a.history[systemIdx+1:]
+// setHistory 用 system 消息与保留的单元重新组合历史
+func (a *Agent) setHistory(systemMsgs []protocol.Message, units [][]protocol.Message) {
+	history := make([]protocol.Message, 0, len(a.history))
+	history = append(history, systemMsgs...)
+	for _, unit := range units {
+		history = append(history, unit...)
 	}
+	a.history = history
+}
 
-	// 如果非 system 消息太多，就截断
-	if len(nonSystemMsgs) > a.maxMessages {
-		keepStart := len(nonSystemMsgs) - a.maxMessages
-		trimmed := nonSystemMsgs[keepStart:]
+// trimHistory 修剪对话历史，确保不超过最大消息数与 token 预算（system 消息除外）
+// 以不可拆分的单元为粒度从最新的消息开始向前保留，工具调用与其结果总是一起保留或一起丢弃，
+// 保留的历史也不会以 tool 消息开头；最新的一个单元总会被保留
+func (a *Agent) trimHistory() {
+	if len(a.history) == 0 {
+		return
+	}
 
-		// 重新组合：保留 system + 最新的消息
-		if systemIdx >= 0 {
-			a.history = append([]protocol.Message{a.history[systemIdx]}, trimmed...)
-		} else {
-			a.history = trimmed
+	systemMsgs, nonSystemMsgs := a.splitSystem()
+	units := splitUnits(nonSystemMsgs)
+
+	// 从最新的单元往前累计，直到超过消息数上限或 token 预算
+	budget := a.historyTokenBudget(systemMsgs)
+	keepStart := len(units)
+	usedTokens, usedMessages := 0, 0
+	for keepStart > 0 {
+		unit := units[keepStart-1]
+		cost := 0
+		for _, msg := range unit {
+			cost += estimateMessageTokens(a.estimator, msg)
+		}
+		if keepStart < len(units) {
+			if usedMessages+len(unit) > a.maxMessages || (budget >= 0 && usedTokens+cost > budget) {
+				break
+			}
 		}
+		usedTokens += cost
+		usedMessages += len(unit)
+		keepStart--
 	}
+
+	// 没有需要丢弃的消息
+	kept := 0
+	for _, unit := range units[keepStart:] {
+		kept += len(unit)
+	}
+	if kept == len(nonSystemMsgs) {
+		return
+	}
+
+	// 重新组合：保留 system + 最新的消息
+	a.setHistory(systemMsgs, units[keepStart:])
 }
 
 // Chat 处理用户输入并返回助手的回复
-// 支持多轮工具调用（最多 3 轮）
-func (a *Agent) Chat(input string) (string, error) {
+// 支持多轮工具调用（最多 5 轮）；ctx 被取消时中止正在进行的模型请求与工具调用
+func (a *Agent) Chat(ctx context.Context, input string) (string, error) {
+	return a.run(ctx, input, nil)
+}
+
+// run 是 Chat 与 ChatStream 共用的对话主循环
+// onEvent 为 nil 时使用非流式接口调用模型，否则使用流式接口并推送事件
+// 本轮失败（包括被取消）时历史会恢复到本轮开始前的状态，避免留下不完整的工具调用
+func (a *Agent) run(ctx context.Context, input string, onEvent EventHandler) (reply string, err error) {
+	a.turnUsage = UsageStats{}
+	saved := append([]protocol.Message(nil), a.history...)
+	defer func() {
+		if err != nil {
+			a.history = saved
+		}
+	}()
+
+	// 获取工具定义（如果启用了工具）
+	var apiTools []model.ToolForAPI
+	if a.toolsEnabled {
+		defs, err := a.toolClient.List(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to list tools: %w", err)
+		} else {
+			apiTools = convertToolDefsToAPI(defs)
+			a.updateToolDefs(defs)
+		}
+	}
+	a.toolTokens = 0
+	if len(apiTools) > 0 {
+		// 工具定义随每次请求发送，同样占用上下文窗口
+		toolsJSON, _ := json.Marshal(apiTools)
+		a.toolTokens = a.estimator.EstimateTokens(string(toolsJSON))
+	}
+
 	// 如果是第一次对话，添加 system 提示
 	if len(a.history) == 0 {
 		systemMsg := protocol.Message{
@@ -88,30 +240,20 @@ func (a *Agent) Chat(input string) (string, error) {
 		Role:    "user",
 		Content: input,
 	})
-	a.trimHistory()
 
-	// 获取工具定义（如果启用了工具）
-	var apiTools []model.ToolForAPI
-	if a.toolsEnabled {
-		defs, err := a.toolClient.List()
-		if err != nil {
-			return "", fmt.Errorf("failed to list tools: %w", err)
-		} else {
-			apiTools = convertToolDefsToAPI(defs)
-		}
+	// 历史过长时先尝试压缩为摘要；压缩失败不影响本轮对话，后续的裁剪仍会保证不超出预算
+	if err := a.maybeCompact(ctx); err != nil && ctx.Err() != nil {
+		return "", ctx.Err()
 	}
+	a.trimHistory()
 
 	// 最多进行 5 轮工具调用（防止无限循环）
 	maxRounds := 5
 	for round := 0; round < maxRounds; round++ {
-		var content string
-		var toolCalls []protocol.ToolCall
-		var err error
-
 		// 调用模型，可能返回文本内容或工具调用请求
-		content, toolCalls, err = a.model.ChatWithTools(a.history, apiTools)
+		content, toolCalls, err := a.callModel(ctx, apiTools, onEvent)
 		if err != nil {
-			return "", fmt.Errorf("failed to call model: %w", err)
+			return "", err
 		}
 
 		// 构造助手的回复消息（可能包含工具调用）
@@ -128,42 +270,12 @@ func (a *Agent) Chat(input string) (string, error) {
 			return content, nil
 		}
 
-		// 执行每个工具调用
-		for _, tc := range toolCalls {
-			// 解析工具参数（JSON 字符串转为 map）
-			var args map[string]interface{}
-			if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
-				// 参数解析失败，记录错误
-				a.history = append(a.history, protocol.Message{
-					Role:       "tool",
-					Name:       tc.Function.Name,
-					ToolCallID: tc.ID,
-					Content:    "Error: invalid arguments JSON",
-				})
-				continue
-			}
-
-			// 调用工具
-			result, err := a.toolClient.Call(tc.Function.Name, args)
-			if err != nil {
-				// 工具执行失败，记录错误
-				a.history = append(a.history, protocol.Message{
-					Role:       "tool",
-					Name:       tc.Function.Name,
-					ToolCallID: tc.ID,
-					Content:    "Error: " + err.Error(),
-				})
-				continue
-			}
-
-			// 工具成功执行，记录结果
-			a.history = append(a.history, protocol.Message{
-				Role:       "tool",
-				Name:       tc.Function.Name,
-				ToolCallID: tc.ID,
-				Content:    result,
-			})
+		// 执行本轮的全部工具调用，结果按调用顺序写入历史
+		toolMsgs, err := a.executeToolCalls(ctx, toolCalls, onEvent)
+		if err != nil {
+			return "", err
 		}
+		a.history = append(a.history, toolMsgs...)
 		a.trimHistory()
 	}
 
@@ -175,6 +287,78 @@ func (a *Agent) Chat(input string) (string, error) {
 	return last.Content, nil
 }
 
+// callModel 调用模型一次，并根据错误类型做不同处理：
+// 上下文超长时丢弃较早的一半历史后重试一次，鉴权失败与限流给出明确提示
+func (a *Agent) callModel(ctx context.Context, apiTools []model.ToolForAPI, onEvent EventHandler) (string, []protocol.ToolCall, error) {
+	var content string
+	var toolCalls []protocol.ToolCall
+	var usage model.Usage
+	var err error
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if onEvent == nil {
+			content, toolCalls, usage, err = a.model.ChatWithTools(ctx, a.history, apiTools, a.options)
+		} else {
+			content, toolCalls, usage, err = a.model.ChatStream(ctx, a.history, apiTools, a.options, func(delta string) {
+				onEvent(Event{Type: EventToken, Text: delta})
+			})
+		}
+		if err == nil {
+			a.recordUsage(usage)
+			return content, toolCalls, nil
+		}
+		if !errors.Is(err, model.ErrContextLengthExceeded) || !a.shrinkHistory() {
+			break
+		}
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		return "", nil, ctx.Err()
+	case errors.Is(err, model.ErrAuthFailed):
+		return "", nil, fmt.Errorf("model authentication failed, check api_key: %w", err)
+	case errors.Is(err, model.ErrRateLimited):
+		return "", nil, fmt.Errorf("model rate limit exceeded, please retry later: %w", err)
+	case errors.Is(err, model.ErrContextLengthExceeded):
+		return "", nil, fmt.Errorf("conversation exceeds model context length, try 'clear': %w", err)
+	default:
+		return "", nil, fmt.Errorf("failed to call model: %w", err)
+	}
+}
+
+// shrinkHistory 丢弃较早的一半历史单元，用于上下文超长后的重试
+// 与 trimHistory 一样以单元为粒度，不会拆散工具调用与其结果；如果已经没有可丢弃的单元则返回 false
+func (a *Agent) shrinkHistory() bool {
+	systemMsgs, nonSystemMsgs := a.splitSystem()
+	units := splitUnits(nonSystemMsgs)
+	if len(units) <= 1 {
+		return false
+	}
+
+	a.setHistory(systemMsgs, units[len(units)/2:])
+	return true
+}
+
+// callTool 解析工具参数并执行一次工具调用
+func (a *Agent) callTool(ctx context.Context, tc protocol.ToolCall) (string, error) {
+	// 解析工具参数（JSON 字符串转为 map）
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments JSON")
+	}
+
+	// 调用前按 schema 校验并转换参数，不符合时把逐项的问题作为工具结果返回给模型，由模型修正后重试
+	if schema, ok := a.toolSchemas[tc.Function.Name]; ok {
+		validated, err := schema.Validate(args)
+		if err != nil {
+			return "", err
+		}
+		args = validated
+	}
+
+	return a.toolClient.Call(ctx, tc.Function.Name, args)
+}
+
 // ClearHistory 清空对话历史（重置上下文）
 func (a *Agent) ClearHistory() {
 	a.history = make([]protocol.Message, 0)
@@ -184,22 +368,18 @@ func (a *Agent) ClearHistory() {
 func convertToolDefsToAPI(defs []tools.ToolDefinition) []model.ToolForAPI {
 	apiTools := make([]model.ToolForAPI, len(defs))
 	for i, def := range defs {
-		// 构建参数属性
-		props := make(map[string]interface{})
-		for name, param := range def.Parameters.Properties {
-			props[name] = map[string]interface{}{
-				"type":        param.Type,
-				"description": param.Description,
-			}
+		// schema 原样转发（enum、items、嵌套对象等都会保留），只补全部分模型 API 要求的 type 与 properties
+		schema := def.Parameters
+		if schema.Type == nil {
+			schema.Type = tools.SchemaType{"object"}
 		}
-
-		// 构建完整的 JSON Schema
-		schema := map[string]interface{}{
-			"type":       "object",
-			"properties": props,
+		if schema.Properties == nil && schema.Type.Has("object") {
+			schema.Properties = map[string]*tools.Schema{}
 		}
-		if len(def.Parameters.Required) > 0 {
-			schema["required"] = def.Parameters.Required
+		params, err := json.Marshal(schema)
+		if err != nil {
+			// 只有 Extra 中含有非法 JSON 时才会失败，退回到不带参数说明的空对象
+			params = json.RawMessage(`{"type":"object","properties":{}}`)
 		}
 
 		// 转换为模型所需的工具格式
@@ -208,7 +388,7 @@ func convertToolDefsToAPI(defs []tools.ToolDefinition) []model.ToolForAPI {
 			Function: model.ToolFuncDef{
 				Name:        def.Name,
 				Description: def.Description,
-				Parameters:  schema,
+				Parameters:  params,
 			},
 		}
 	}
@@ -0,0 +1,325 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/quick"
+
+	"github.com/windlant/mcp-client/internal/model"
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// randomHistory 是由随机的用户消息、助手回复与工具调用轮次组成的合法历史，以及随机的裁剪参数
+type randomHistory struct {
+	Messages      []protocol.Message
+	MaxMessages   int
+	MaxTokens     int // 为 0 时只按消息数裁剪
+	ReserveTokens int
+}
+
+// Generate 实现 quick.Generator
+func (randomHistory) Generate(r *rand.Rand, size int) reflect.Value {
+	h := randomHistory{
+		MaxMessages: 1 + r.Intn(12),
+	}
+	if r.Intn(2) == 0 {
+		h.MaxTokens = 20 + r.Intn(400)
+		h.ReserveTokens = r.Intn(40)
+	}
+
+	h.Messages = append(h.Messages, protocol.Message{Role: "system", Content: "You are a helpful assistant."})
+	if r.Intn(4) == 0 {
+		// 压缩后的摘要紧跟在 system 消息之后
+		h.Messages = append(h.Messages, protocol.Message{Role: "system", Content: "Summary: " + words(r, 10)})
+	}
+
+	call := 0
+	for turns := r.Intn(size + 1); turns > 0; turns-- {
+		h.Messages = append(h.Messages, protocol.Message{Role: "user", Content: words(r, 1+r.Intn(30))})
+		for rounds := r.Intn(3); rounds > 0; rounds-- {
+			n := 1 + r.Intn(3)
+			assistant := protocol.Message{Role: "assistant"}
+			var results []protocol.Message
+			for k := 0; k < n; k++ {
+				call++
+				id := fmt.Sprintf("call_%d", call)
+				assistant.ToolCalls = append(assistant.ToolCalls, protocol.ToolCall{
+					ID:       id,
+					Type:     "function",
+					Function: protocol.Function{Name: "get_current_time", Arguments: "{}"},
+				})
+				results = append(results, protocol.Message{
+					Role:       "tool",
+					Name:       "get_current_time",
+					ToolCallID: id,
+					Content:    words(r, r.Intn(60)),
+				})
+			}
+			h.Messages = append(h.Messages, assistant)
+			h.Messages = append(h.Messages, results...)
+		}
+		h.Messages = append(h.Messages, protocol.Message{Role: "assistant", Content: words(r, 1+r.Intn(30))})
+	}
+	return reflect.ValueOf(h)
+}
+
+// words 生成 n 个随机单词
+func words(r *rand.Rand, n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = strings.Repeat("x", 1+r.Intn(8))
+	}
+	return strings.Join(parts, " ")
+}
+
+// checkHistory 检查历史能被模型 API 接受：tool 消息都紧跟在发起对应调用的助手消息之后，
+// 带有 ToolCalls 的助手消息保留了全部结果，system 消息之后的窗口不以 tool 消息开头
+func checkHistory(history []protocol.Message) error {
+	start := 0
+	for start < len(history) && history[start].Role == "system" {
+		start++
+	}
+	if start < len(history) && history[start].Role == "tool" {
+		return fmt.Errorf("window starts with a tool message at %d", start)
+	}
+
+	for i := start; i < len(history); i++ {
+		msg := history[i]
+		switch {
+		case msg.Role == "system":
+			return fmt.Errorf("system message inside the window at %d", i)
+		case msg.Role == "tool":
+			// 向前找到发起调用的助手消息，中间只能是 tool 消息
+			j := i - 1
+			for j >= start && history[j].Role == "tool" {
+				j--
+			}
+			if j < start || history[j].Role != "assistant" || !hasToolCall(history[j], msg.ToolCallID) {
+				return fmt.Errorf("tool message %s at %d has no matching assistant tool call", msg.ToolCallID, i)
+			}
+		case msg.Role == "assistant" && len(msg.ToolCalls) > 0:
+			answered := make(map[string]bool)
+			for j := i + 1; j < len(history) && history[j].Role == "tool"; j++ {
+				answered[history[j].ToolCallID] = true
+			}
+			for _, tc := range msg.ToolCalls {
+				if !answered[tc.ID] {
+					return fmt.Errorf("assistant message at %d lost the result of %s", i, tc.ID)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func hasToolCall(msg protocol.Message, id string) bool {
+	for _, tc := range msg.ToolCalls {
+		if tc.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestAgent(h randomHistory) *Agent {
+	a := NewAgent(nil, h.MaxMessages, true, nil)
+	a.SetTokenBudget(h.MaxTokens, h.ReserveTokens, 0)
+	a.history = append([]protocol.Message(nil), h.Messages...)
+	return a
+}
+
+func TestTrimHistoryKeepsValidHistory(t *testing.T) {
+	property := func(h randomHistory) bool {
+		if err := checkHistory(h.Messages); err != nil {
+			t.Fatalf("generator produced an invalid history: %v", err)
+		}
+
+		a := newTestAgent(h)
+		a.trimHistory()
+		if err := checkHistory(a.history); err != nil {
+			t.Logf("maxMessages=%d maxTokens=%d: %v", h.MaxMessages, h.MaxTokens, err)
+			return false
+		}
+		// system 消息总是保留
+		if len(a.history) == 0 || a.history[0].Role != "system" {
+			t.Logf("system message was dropped")
+			return false
+		}
+		return true
+	}
+
+	cfg := &quick.Config{MaxCount: 2000, Rand: rand.New(rand.NewSource(1))}
+	if err := quick.Check(property, cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShrinkHistoryKeepsValidHistory(t *testing.T) {
+	property := func(h randomHistory) bool {
+		a := newTestAgent(h)
+		for a.shrinkHistory() {
+			if err := checkHistory(a.history); err != nil {
+				t.Log(err)
+				return false
+			}
+		}
+		return checkHistory(a.history) == nil
+	}
+
+	cfg := &quick.Config{MaxCount: 500, Rand: rand.New(rand.NewSource(2))}
+	if err := quick.Check(property, cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrimHistoryDropsLeadingToolMessages(t *testing.T) {
+	a := NewAgent(nil, 10, true, nil)
+	a.history = []protocol.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "tool", ToolCallID: "orphan", Content: "late result"},
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "hello"},
+	}
+	a.trimHistory()
+	if err := checkHistory(a.history); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.history) != 3 {
+		t.Fatalf("got %d messages, want 3", len(a.history))
+	}
+}
+
+func TestTrimHistoryRespectsTokenBudget(t *testing.T) {
+	a := NewAgent(nil, 1000, true, nil)
+	a.SetTokenBudget(200, 50, 0)
+	a.history = []protocol.Message{{Role: "system", Content: "sys"}}
+	for i := 0; i < 50; i++ {
+		a.history = append(a.history,
+			protocol.Message{Role: "user", Content: strings.Repeat("word ", 20)},
+			protocol.Message{Role: "assistant", Content: strings.Repeat("word ", 20)},
+		)
+	}
+	a.trimHistory()
+
+	systemMsgs, rest := a.splitSystem()
+	used := 0
+	for _, msg := range rest {
+		used += estimateMessageTokens(a.estimator, msg)
+	}
+	if budget := a.historyTokenBudget(systemMsgs); used > budget {
+		t.Fatalf("history uses %d tokens, budget is %d", used, budget)
+	}
+	if len(rest) == 0 {
+		t.Fatal("the latest message must always be kept")
+	}
+}
+
+func TestSetCompactionDefaults(t *testing.T) {
+	a := NewAgent(nil, 10, true, nil)
+	a.SetCompaction(CompactionOptions{Enabled: true, Threshold: 100})
+	if a.compaction.KeepRecent != DefaultKeepRecent || a.compaction.Prompt != DefaultSummaryPrompt {
+		t.Fatalf("defaults not applied: %+v", a.compaction)
+	}
+
+	a.SetCompaction(CompactionOptions{KeepRecent: 2, Prompt: "summarize"})
+	if a.compaction.KeepRecent != 2 || a.compaction.Prompt != "summarize" {
+		t.Fatalf("configured values overwritten: %+v", a.compaction)
+	}
+}
+
+// fakeModel 按 respond 的返回值回复，并记录每次请求的消息
+type fakeModel struct {
+	mu       sync.Mutex
+	requests [][]protocol.Message
+	respond  func(ctx context.Context, messages []protocol.Message) (string, []protocol.ToolCall, error)
+}
+
+func (m *fakeModel) Chat(ctx context.Context, messages []protocol.Message) (string, error) {
+	content, _, _, err := m.ChatWithTools(ctx, messages, nil, nil)
+	return content, err
+}
+
+func (m *fakeModel) ChatWithTools(ctx context.Context, messages []protocol.Message, _ []model.ToolForAPI, _ *model.ChatOptions) (string, []protocol.ToolCall, model.Usage, error) {
+	m.mu.Lock()
+	m.requests = append(m.requests, append([]protocol.Message(nil), messages...))
+	m.mu.Unlock()
+	content, calls, err := m.respond(ctx, messages)
+	return content, calls, model.Usage{}, err
+}
+
+func (m *fakeModel) ChatStream(ctx context.Context, messages []protocol.Message, apiTools []model.ToolForAPI, opts *model.ChatOptions, _ model.StreamHandler) (string, []protocol.ToolCall, model.Usage, error) {
+	return m.ChatWithTools(ctx, messages, apiTools, opts)
+}
+
+// fakeToolClient 提供 defs 中的工具，调用交给 call 处理并记录调用的工具名
+type fakeToolClient struct {
+	defs []tools.ToolDefinition
+	call func(ctx context.Context, name string, args tools.ToolArguments) (string, error)
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (c *fakeToolClient) Call(ctx context.Context, name string, args tools.ToolArguments) (string, error) {
+	c.mu.Lock()
+	c.calls = append(c.calls, name)
+	c.mu.Unlock()
+	return c.call(ctx, name, args)
+}
+
+func (c *fakeToolClient) List(ctx context.Context) ([]tools.ToolDefinition, error) {
+	return c.defs, nil
+}
+
+func (c *fakeToolClient) Close() error { return nil }
+
+func toolCall(id, name, args string) protocol.ToolCall {
+	return protocol.ToolCall{ID: id, Type: "function", Function: protocol.Function{Name: name, Arguments: args}}
+}
+
+func TestInvalidArgumentsAreReturnedToTheModel(t *testing.T) {
+	tc := &fakeToolClient{
+		defs: []tools.ToolDefinition{{
+			Name: "repeat",
+			Parameters: tools.Schema{
+				Type:       tools.SchemaType{"object"},
+				Properties: map[string]*tools.Schema{"times": {Type: tools.SchemaType{"integer"}}},
+				Required:   []string{"times"},
+			},
+		}},
+		call: func(ctx context.Context, name string, args tools.ToolArguments) (string, error) {
+			return "called", nil
+		},
+	}
+	m := &fakeModel{}
+	m.respond = func(ctx context.Context, messages []protocol.Message) (string, []protocol.ToolCall, error) {
+		if len(m.requests) == 1 {
+			return "", []protocol.ToolCall{toolCall("call_1", "repeat", `{"times":"abc"}`)}, nil
+		}
+		return "fixed", nil, nil
+	}
+
+	a := NewAgent(m, 20, true, tc)
+	reply, err := a.Chat(context.Background(), "repeat it")
+	if err != nil || reply != "fixed" {
+		t.Fatalf("got %q, %v", reply, err)
+	}
+	if len(tc.calls) != 0 {
+		t.Fatalf("tool client was called with invalid arguments: %v", tc.calls)
+	}
+
+	// 第二次请求的最后一条消息是校验失败的工具结果
+	last := m.requests[1][len(m.requests[1])-1]
+	if last.Role != "tool" || last.ToolCallID != "call_1" || !last.IsError {
+		t.Fatalf("got %+v, want an IsError tool result", last)
+	}
+	if !strings.HasPrefix(last.Content, "Error: invalid arguments") || !strings.Contains(last.Content, "times: expected integer") {
+		t.Fatalf("tool result %q does not explain the problem", last.Content)
+	}
+}
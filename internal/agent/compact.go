@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+)
+
+// DefaultSummaryPrompt 是未配置 summary_prompt 时用于生成对话摘要的提示词
+const DefaultSummaryPrompt = `You are compressing the earlier part of a conversation between a user and an AI assistant so that the assistant can continue it with a limited context window.
+Write a concise summary that preserves every fact, user preference, decision, name, identifier, number and open question that later turns may depend on, including the relevant results of tool calls.
+If a previous summary is included, merge it into the new one. Write the summary in the language the user has been using. Output only the summary.`
+
+// DefaultKeepRecent 是未配置 compact_keep_recent 时压缩后原样保留的最近单元数
+const DefaultKeepRecent = 6
+
+// summaryPrefix 是摘要消息内容的固定前缀，用于在历史中识别摘要消息
+const summaryPrefix = "Conversation summary (earlier turns were compacted):\n"
+
+// CompactionOptions 描述对话压缩的配置
+type CompactionOptions struct {
+	Enabled    bool   // 是否在历史超过阈值时自动压缩
+	Threshold  int    // 触发自动压缩的历史 token 数（不含 system 消息）
+	KeepRecent int    // 压缩时原样保留的最近单元数（一个单元是一条消息或一次工具调用及其结果），不大于 0 时使用 DefaultKeepRecent
+	Prompt     string // 生成摘要的提示词，为空时使用 DefaultSummaryPrompt
+}
+
+// withDefaults 返回未设置的字段填入默认值后的配置
+func (o CompactionOptions) withDefaults() CompactionOptions {
+	if o.KeepRecent <= 0 {
+		o.KeepRecent = DefaultKeepRecent
+	}
+	if o.Prompt == "" {
+		o.Prompt = DefaultSummaryPrompt
+	}
+	return o
+}
+
+// SetCompaction 设置对话压缩的配置
+func (a *Agent) SetCompaction(opts CompactionOptions) {
+	a.compaction = opts.withDefaults()
+}
+
+// Compact 调用模型将较早的对话总结为一条固定在 system 消息之后的摘要消息，最近的若干单元原样保留
+// 返回是否进行了压缩；历史太短无需压缩时返回 false
+func (a *Agent) Compact(ctx context.Context) (bool, error) {
+	opts := a.compaction.withDefaults()
+	systemMsgs, nonSystemMsgs := a.splitSystem()
+	units := splitUnits(nonSystemMsgs)
+
+	keepRecent := opts.KeepRecent
+	if len(units) <= keepRecent {
+		return false, nil
+	}
+	older, recent := units[:len(units)-keepRecent], units[len(units)-keepRecent:]
+
+	// 将已有摘要与较早的对话一并交给模型，生成新的摘要
+	var transcript strings.Builder
+	var baseSystem []protocol.Message
+	for _, msg := range systemMsgs {
+		if strings.HasPrefix(msg.Content, summaryPrefix) {
+			transcript.WriteString("Previous summary:\n")
+			transcript.WriteString(strings.TrimPrefix(msg.Content, summaryPrefix))
+			transcript.WriteString("\n\n")
+			continue
+		}
+		baseSystem = append(baseSystem, msg)
+	}
+	transcript.WriteString("Conversation to summarize:\n")
+	for _, unit := range older {
+		for _, msg := range unit {
+			writeTranscriptMessage(&transcript, msg)
+		}
+	}
+
+	request := []protocol.Message{
+		{Role: "system", Content: opts.Prompt},
+		{Role: "user", Content: transcript.String()},
+	}
+
+	summary, _, usage, err := a.model.ChatWithTools(ctx, request, nil, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	a.recordUsage(usage)
+
+	pinned := append(baseSystem, protocol.Message{
+		Role:    "system",
+		Content: summaryPrefix + strings.TrimSpace(summary),
+	})
+	a.setHistory(pinned, recent)
+	return true, nil
+}
+
+// maybeCompact 在启用自动压缩且历史超过阈值时压缩对话
+func (a *Agent) maybeCompact(ctx context.Context) error {
+	if !a.compaction.Enabled || a.compaction.Threshold <= 0 {
+		return nil
+	}
+
+	_, nonSystemMsgs := a.splitSystem()
+	tokens := 0
+	for _, msg := range nonSystemMsgs {
+		tokens += estimateMessageTokens(a.estimator, msg)
+	}
+	if tokens <= a.compaction.Threshold {
+		return nil
+	}
+
+	_, err := a.Compact(ctx)
+	return err
+}
+
+// writeTranscriptMessage 将一条消息以纯文本形式写入用于总结的对话记录
+func writeTranscriptMessage(b *strings.Builder, msg protocol.Message) {
+	switch {
+	case msg.Role == "tool":
+		fmt.Fprintf(b, "[tool result: %s]\n%s\n\n", msg.Name, msg.Content)
+	case len(msg.ToolCalls) > 0:
+		if msg.Content != "" && msg.Content != "{}" {
+			fmt.Fprintf(b, "%s: %s\n", msg.Role, msg.Content)
+		}
+		for _, tc := range msg.ToolCalls {
+			fmt.Fprintf(b, "[%s called tool %s with %s]\n", msg.Role, tc.Function.Name, tc.Function.Arguments)
+		}
+		b.WriteString("\n")
+	default:
+		fmt.Fprintf(b, "%s: %s\n\n", msg.Role, msg.Content)
+	}
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+)
+
+// newCompactAgent 创建历史为 system 消息、一条旧摘要与 6 个单元（其中一个是工具调用及其结果）的 Agent
+func newCompactAgent(m *fakeModel, keepRecent int) *Agent {
+	a := NewAgent(m, 100, true, nil)
+	a.SetCompaction(CompactionOptions{KeepRecent: keepRecent, Prompt: "summarize"})
+	a.history = []protocol.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "system", Content: summaryPrefix + "user is called Ada"},
+		{Role: "user", Content: "u1"},
+		{Role: "assistant", Content: "a1"},
+		{Role: "user", Content: "u2"},
+		{Role: "assistant", ToolCalls: []protocol.ToolCall{toolCall("call_1", "get_time", `{"tz":"UTC"}`)}},
+		{Role: "tool", ToolCallID: "call_1", Name: "get_time", Content: "12:00"},
+		{Role: "user", Content: "u3"},
+		{Role: "assistant", Content: "a3"},
+	}
+	return a
+}
+
+func TestCompactSummarizesOlderUnits(t *testing.T) {
+	m := &fakeModel{respond: func(ctx context.Context, messages []protocol.Message) (string, []protocol.ToolCall, error) {
+		return "  Ada asked for the time.  ", nil, nil
+	}}
+	a := newCompactAgent(m, 3)
+
+	compacted, err := a.Compact(context.Background())
+	if err != nil || !compacted {
+		t.Fatalf("Compact = %v, %v; want compacted", compacted, err)
+	}
+
+	// 旧摘要被新摘要取代；工具调用与其结果属于同一单元，一起保留
+	want := []protocol.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "system", Content: summaryPrefix + "Ada asked for the time."},
+		{Role: "assistant", ToolCalls: []protocol.ToolCall{toolCall("call_1", "get_time", `{"tz":"UTC"}`)}},
+		{Role: "tool", ToolCallID: "call_1", Name: "get_time", Content: "12:00"},
+		{Role: "user", Content: "u3"},
+		{Role: "assistant", Content: "a3"},
+	}
+	if !reflect.DeepEqual(a.history, want) {
+		t.Fatalf("history after compaction:\n%+v\nwant:\n%+v", a.history, want)
+	}
+	if err := checkHistory(a.history); err != nil {
+		t.Fatal(err)
+	}
+
+	// 摘要请求包含旧摘要与较早的单元，不包含保留的单元
+	if len(m.requests) != 1 || len(m.requests[0]) != 2 || m.requests[0][0].Content != "summarize" {
+		t.Fatalf("summary request = %+v", m.requests)
+	}
+	transcript := m.requests[0][1].Content
+	for _, s := range []string{"Previous summary:\nuser is called Ada", "user: u1", "assistant: a1", "user: u2"} {
+		if !strings.Contains(transcript, s) {
+			t.Errorf("transcript does not contain %q:\n%s", s, transcript)
+		}
+	}
+	for _, s := range []string{"get_time", "u3", "a3", "sys"} {
+		if strings.Contains(transcript, s) {
+			t.Errorf("transcript contains kept message %q:\n%s", s, transcript)
+		}
+	}
+}
+
+func TestCompactSkipsShortHistory(t *testing.T) {
+	m := &fakeModel{respond: func(ctx context.Context, messages []protocol.Message) (string, []protocol.ToolCall, error) {
+		return "summary", nil, nil
+	}}
+	a := newCompactAgent(m, 6)
+	before := append([]protocol.Message(nil), a.history...)
+
+	compacted, err := a.Compact(context.Background())
+	if err != nil || compacted {
+		t.Fatalf("Compact = %v, %v; want nothing to compact", compacted, err)
+	}
+	if len(m.requests) != 0 || !reflect.DeepEqual(a.history, before) {
+		t.Fatalf("short history was summarized: %+v", a.history)
+	}
+}
+
+func TestCompactFailureKeepsHistory(t *testing.T) {
+	m := &fakeModel{respond: func(ctx context.Context, messages []protocol.Message) (string, []protocol.ToolCall, error) {
+		return "", nil, errors.New("rate limited")
+	}}
+	a := newCompactAgent(m, 2)
+	before := append([]protocol.Message(nil), a.history...)
+
+	compacted, err := a.Compact(context.Background())
+	if compacted || err == nil || !strings.Contains(err.Error(), "rate limited") {
+		t.Fatalf("Compact = %v, %v; want the summarizer error", compacted, err)
+	}
+	if !reflect.DeepEqual(a.history, before) {
+		t.Fatalf("history changed after a failed compaction:\n%+v", a.history)
+	}
+}
+
+func TestCompactPassesContextToSummarizer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &fakeModel{respond: func(callCtx context.Context, messages []protocol.Message) (string, []protocol.ToolCall, error) {
+		cancel()
+		<-callCtx.Done()
+		return "", nil, callCtx.Err()
+	}}
+	a := newCompactAgent(m, 2)
+	before := append([]protocol.Message(nil), a.history...)
+
+	if _, err := a.Compact(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	if !reflect.DeepEqual(a.history, before) {
+		t.Fatalf("history changed after a cancelled compaction:\n%+v", a.history)
+	}
+}
@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+)
+
+// EventType 标识流式对话过程中推送的事件类型
+type EventType int
+
+const (
+	EventToken            EventType = iota // 模型输出的一段文本增量
+	EventToolCallStarted                   // 开始执行一次工具调用
+	EventToolCallFinished                  // 一次工具调用执行完毕
+)
+
+// Event 是流式对话过程中推送给调用方的事件
+type Event struct {
+	Type     EventType
+	Text     string            // EventToken 携带的文本增量
+	ToolCall protocol.ToolCall // 工具调用事件对应的调用请求
+	Result   string            // EventToolCallFinished 携带的工具执行结果
+	Err      error             // EventToolCallFinished 中工具执行失败时的错误
+}
+
+// EventHandler 接收流式对话中的事件
+type EventHandler func(Event)
+
+// ChatStream 是 Chat 的流式版本：模型输出的文本增量与工具调用的开始/结束
+// 都会在发生时通过 onEvent 推送，返回值与 Chat 相同（完整的最终回复）
+func (a *Agent) ChatStream(ctx context.Context, input string, onEvent EventHandler) (string, error) {
+	if onEvent == nil {
+		onEvent = func(Event) {}
+	}
+	return a.run(ctx, input, onEvent)
+}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"fmt"
+	"unicode"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+)
+
+// TokenEstimator 估算文本占用的 token 数，可替换为与具体模型一致的分词器
+type TokenEstimator interface {
+	EstimateTokens(text string) int
+}
+
+// ApproxTokenEstimator 是内置的近似估算器，不依赖具体模型的词表：
+// - 中日韩字符按每字 1 个 token 计算
+// - 拉丁字母与数字组成的单词按每 4 个字符 1 个 token 计算（不足 4 个按 1 个）
+// - 标点与其他符号各按 1 个 token 计算，空白不计
+type ApproxTokenEstimator struct{}
+
+// EstimateTokens 实现 TokenEstimator 接口
+func (ApproxTokenEstimator) EstimateTokens(text string) int {
+	tokens := 0
+	wordLen := 0
+	flushWord := func() {
+		if wordLen > 0 {
+			tokens += (wordLen + 3) / 4
+			wordLen = 0
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			wordLen++
+		case unicode.IsSpace(r):
+			flushWord()
+		default:
+			flushWord()
+			tokens++
+		}
+	}
+	flushWord()
+	return tokens
+}
+
+// isCJK 判断字符是否属于中日韩文字
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
+
+// messageOverheadTokens 是每条消息在角色、分隔符等格式上的固定开销
+const messageOverheadTokens = 4
+
+// estimateMessageTokens 估算一条消息占用的 token 数，包括内容、工具调用与格式开销
+func estimateMessageTokens(e TokenEstimator, msg protocol.Message) int {
+	tokens := messageOverheadTokens + e.EstimateTokens(msg.Content)
+	for _, tc := range msg.ToolCalls {
+		tokens += e.EstimateTokens(tc.Function.Name) + e.EstimateTokens(tc.Function.Arguments)
+	}
+	return tokens
+}
+
+// truncateToTokens 将文本截断到大约 maxTokens 个 token，并注明被截断的部分
+func truncateToTokens(e TokenEstimator, text string, maxTokens int) string {
+	total := e.EstimateTokens(text)
+	if maxTokens <= 0 || total <= maxTokens {
+		return text
+	}
+
+	// 二分查找能放进预算的最长前缀（按字符计）
+	runes := []rune(text)
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if e.EstimateTokens(string(runes[:mid])) <= maxTokens {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	kept := string(runes[:lo])
+	return kept + fmt.Sprintf("\n...[truncated, about %d tokens omitted]", total-e.EstimateTokens(kept))
+}
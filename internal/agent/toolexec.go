@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// ToolExecOptions 描述同一轮中多个工具调用的执行方式
+type ToolExecOptions struct {
+	MaxParallel int           // 同时执行的工具调用数上限，小于等于 1 时逐个执行
+	Timeout     time.Duration // 单次工具调用的超时时间，0 表示不限制
+	Sequential  []string      // 不与其他调用并行执行的工具名称，补充工具定义中的 Sequential 声明
+}
+
+// SetToolExecution 设置工具调用的并发数、超时与不可并行的工具
+func (a *Agent) SetToolExecution(opts ToolExecOptions) {
+	a.toolExec = opts
+}
+
+// updateToolDefs 根据本轮的工具定义与配置，更新不可并行执行的工具集合与用于校验参数的 schema
+func (a *Agent) updateToolDefs(defs []tools.ToolDefinition) {
+	a.sequentialTools = make(map[string]bool)
+	a.toolSchemas = make(map[string]tools.Schema, len(defs))
+	for _, def := range defs {
+		if def.Sequential {
+			a.sequentialTools[def.Name] = true
+		}
+		a.toolSchemas[def.Name] = def.Parameters
+	}
+	for _, name := range a.toolExec.Sequential {
+		a.sequentialTools[name] = true
+	}
+}
+
+// toolCallResult 是一次工具调用的执行结果
+type toolCallResult struct {
+	result string
+	err    error
+}
+
+// executeToolCalls 执行模型在一轮中返回的全部工具调用，并按调用的原始顺序返回 tool 消息
+// 连续的可并行调用以不超过 MaxParallel 的并发数同时执行，不可并行的调用单独执行，
+// 因此它与前后调用的先后关系保持不变；ctx 被取消时返回 ctx.Err()
+func (a *Agent) executeToolCalls(ctx context.Context, toolCalls []protocol.ToolCall, onEvent EventHandler) ([]protocol.Message, error) {
+	// 多个调用可能同时推送事件，串行化回调，调用方无需自行加锁
+	var eventMu sync.Mutex
+	emit := func(e Event) {
+		if onEvent == nil {
+			return
+		}
+		eventMu.Lock()
+		defer eventMu.Unlock()
+		onEvent(e)
+	}
+
+	limit := a.toolExec.MaxParallel
+	if limit < 1 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+
+	results := make([]toolCallResult, len(toolCalls))
+	for i := 0; i < len(toolCalls); {
+		if a.sequentialTools[toolCalls[i].Function.Name] {
+			results[i] = a.runToolCall(ctx, toolCalls[i], emit)
+			i++
+			continue
+		}
+
+		var wg sync.WaitGroup
+		for ; i < len(toolCalls) && !a.sequentialTools[toolCalls[i].Function.Name]; i++ {
+			wg.Add(1)
+			go func(k int) {
+				defer wg.Done()
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					results[k] = toolCallResult{err: ctx.Err()}
+					return
+				}
+				defer func() { <-sem }()
+				results[k] = a.runToolCall(ctx, toolCalls[k], emit)
+			}(i)
+		}
+		wg.Wait()
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	msgs := make([]protocol.Message, len(toolCalls))
+	for i, tc := range toolCalls {
+		result := results[i].result
+		if results[i].err != nil {
+			result = "Error: " + results[i].err.Error()
+		}
+		msgs[i] = protocol.Message{
+			Role:       "tool",
+			Name:       tc.Function.Name,
+			ToolCallID: tc.ID,
+			Content:    a.truncateToolResult(result),
+			IsError:    results[i].err != nil,
+		}
+	}
+	return msgs, nil
+}
+
+// runToolCall 在超时限制内执行一次工具调用，并推送开始/结束事件
+// 超时通过 ctx 交给工具客户端，由它取消进行中的调用（MCP 客户端会通知服务器），而不是在这里放弃等待后任由调用继续运行
+func (a *Agent) runToolCall(ctx context.Context, tc protocol.ToolCall, emit EventHandler) toolCallResult {
+	callCtx := ctx
+	if a.toolExec.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, a.toolExec.Timeout)
+		defer cancel()
+	}
+
+	emit(Event{Type: EventToolCallStarted, ToolCall: tc})
+
+	result, err := a.callTool(callCtx, tc)
+	res := toolCallResult{result: result, err: err}
+
+	if ctx.Err() != nil {
+		return toolCallResult{err: ctx.Err()}
+	}
+	if res.err != nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		res.err = fmt.Errorf("tool call timed out after %s", a.toolExec.Timeout)
+	}
+
+	emit(Event{Type: EventToolCallFinished, ToolCall: tc, Result: res.result, Err: res.err})
+	return res
+}
@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// newToolExecAgent 创建一个按 opts 执行 client 中工具的 Agent
+func newToolExecAgent(client *fakeToolClient, opts ToolExecOptions) *Agent {
+	a := NewAgent(nil, 20, true, client)
+	a.SetToolExecution(opts)
+	a.updateToolDefs(client.defs)
+	return a
+}
+
+func TestToolResultsKeepCallOrder(t *testing.T) {
+	const n = 8
+	client := &fakeToolClient{
+		defs: []tools.ToolDefinition{{Name: "work"}},
+		call: func(ctx context.Context, name string, args tools.ToolArguments) (string, error) {
+			// 后发起的调用先完成
+			i := int(args["i"].(float64))
+			time.Sleep(time.Duration(n-i) * 5 * time.Millisecond)
+			if i == 3 {
+				return "", errors.New("disk full")
+			}
+			return fmt.Sprintf("result %d", i), nil
+		},
+	}
+	a := newToolExecAgent(client, ToolExecOptions{MaxParallel: n})
+
+	var calls []protocol.ToolCall
+	for i := 0; i < n; i++ {
+		calls = append(calls, toolCall(fmt.Sprintf("call_%d", i), "work", fmt.Sprintf(`{"i":%d}`, i)))
+	}
+	msgs, err := a.executeToolCalls(context.Background(), calls, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, msg := range msgs {
+		if msg.Role != "tool" || msg.ToolCallID != calls[i].ID {
+			t.Fatalf("message %d answers %q, want %q", i, msg.ToolCallID, calls[i].ID)
+		}
+		want := fmt.Sprintf("result %d", i)
+		if i == 3 {
+			want = "Error: disk full"
+		}
+		if msg.Content != want || msg.IsError != (i == 3) {
+			t.Errorf("message %d = %q (IsError %v), want %q", i, msg.Content, msg.IsError, want)
+		}
+	}
+}
+
+func TestToolConcurrencyLimit(t *testing.T) {
+	const limit = 3
+	var active, peak int32
+	client := &fakeToolClient{
+		defs: []tools.ToolDefinition{{Name: "work"}},
+		call: func(ctx context.Context, name string, args tools.ToolArguments) (string, error) {
+			now := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			return "ok", nil
+		},
+	}
+	a := newToolExecAgent(client, ToolExecOptions{MaxParallel: limit})
+
+	var calls []protocol.ToolCall
+	for i := 0; i < 10; i++ {
+		calls = append(calls, toolCall(fmt.Sprintf("call_%d", i), "work", "{}"))
+	}
+	if _, err := a.executeToolCalls(context.Background(), calls, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&peak); got != limit {
+		t.Errorf("at most %d calls ran at once, want %d", got, limit)
+	}
+}
+
+func TestSequentialToolsRunAlone(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(e string) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+	client := &fakeToolClient{
+		defs: []tools.ToolDefinition{
+			{Name: "read"},
+			{Name: "write", Sequential: true}, // 工具定义中声明
+			{Name: "delete"},                  // 在配置中声明
+		},
+		call: func(ctx context.Context, name string, args tools.ToolArguments) (string, error) {
+			id := args["id"].(string)
+			record("start " + id)
+			time.Sleep(10 * time.Millisecond)
+			record("end " + id)
+			return "ok", nil
+		},
+	}
+	a := newToolExecAgent(client, ToolExecOptions{MaxParallel: 4, Sequential: []string{"delete"}})
+
+	calls := []protocol.ToolCall{
+		toolCall("1", "read", `{"id":"r1"}`),
+		toolCall("2", "read", `{"id":"r2"}`),
+		toolCall("3", "write", `{"id":"w"}`),
+		toolCall("4", "read", `{"id":"r3"}`),
+		toolCall("5", "delete", `{"id":"d"}`),
+		toolCall("6", "read", `{"id":"r4"}`),
+	}
+	if _, err := a.executeToolCalls(context.Background(), calls, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	index := make(map[string]int)
+	for i, e := range events {
+		index[e] = i
+	}
+	// 不可并行的调用在它之前的调用全部结束后才开始，并在之后的调用开始前结束
+	for _, seq := range []string{"w", "d"} {
+		if index["end "+seq] != index["start "+seq]+1 {
+			t.Errorf("%s overlapped with another call: %v", seq, events)
+		}
+	}
+	before := map[string][]string{"w": {"r1", "r2"}, "d": {"r1", "r2", "w", "r3"}}
+	for seq, ids := range before {
+		for _, id := range ids {
+			if index["end "+id] > index["start "+seq] {
+				t.Errorf("%s started before %s finished: %v", seq, id, events)
+			}
+		}
+	}
+	if index["start r3"] < index["end w"] || index["start r4"] < index["end d"] {
+		t.Errorf("a later call started before the sequential call finished: %v", events)
+	}
+}
+
+func TestToolTimeoutCancelsTheCall(t *testing.T) {
+	returned := make(chan error, 1)
+	client := &fakeToolClient{
+		defs: []tools.ToolDefinition{{Name: "slow"}},
+		call: func(ctx context.Context, name string, args tools.ToolArguments) (string, error) {
+			<-ctx.Done()
+			returned <- ctx.Err()
+			return "", ctx.Err()
+		},
+	}
+	a := newToolExecAgent(client, ToolExecOptions{Timeout: 50 * time.Millisecond})
+
+	msgs, err := a.executeToolCalls(context.Background(), []protocol.ToolCall{toolCall("call_1", "slow", "{}")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msgs[0].IsError || !strings.Contains(msgs[0].Content, "timed out after 50ms") {
+		t.Errorf("result = %q (IsError %v), want a timeout error", msgs[0].Content, msgs[0].IsError)
+	}
+
+	// 工具客户端看到了超时，并且在本轮结束前已经返回
+	select {
+	case err := <-returned:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("tool saw %v, want context.DeadlineExceeded", err)
+		}
+	default:
+		t.Error("tool call was still running after executeToolCalls returned")
+	}
+}
+
+func TestToolExecutionStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &fakeToolClient{
+		defs: []tools.ToolDefinition{{Name: "slow"}},
+		call: func(callCtx context.Context, name string, args tools.ToolArguments) (string, error) {
+			cancel()
+			<-callCtx.Done()
+			return "", callCtx.Err()
+		},
+	}
+	a := newToolExecAgent(client, ToolExecOptions{MaxParallel: 2})
+
+	calls := []protocol.ToolCall{toolCall("1", "slow", "{}"), toolCall("2", "slow", "{}")}
+	if _, err := a.executeToolCalls(ctx, calls, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,66 @@
+package agent
+
+import "github.com/windlant/mcp-client/internal/model"
+
+// Price 描述模型每百万 token 的价格
+type Price struct {
+	Prompt       float64 // 未命中缓存的输入
+	Completion   float64 // 输出
+	CachedPrompt float64 // 命中缓存的输入，为 0 时按 Prompt 计价
+}
+
+// Cost 计算给定用量的费用
+func (p Price) Cost(u model.Usage) float64 {
+	cachedPrice := p.CachedPrompt
+	if cachedPrice == 0 {
+		cachedPrice = p.Prompt
+	}
+	uncached := u.PromptTokens - u.CachedPromptTokens
+	return (float64(uncached)*p.Prompt +
+		float64(u.CachedPromptTokens)*cachedPrice +
+		float64(u.CompletionTokens)*p.Completion) / 1e6
+}
+
+// UsageStats 汇总若干次模型请求的 token 用量与费用
+type UsageStats struct {
+	Requests int         // 模型请求次数
+	Usage    model.Usage // 累计用量
+	Cost     float64     // 累计费用，未配置价格时为 0
+}
+
+// add 累加一次模型请求的用量
+func (s *UsageStats) add(u model.Usage, cost float64) {
+	s.Requests++
+	s.Usage.Add(u)
+	s.Cost += cost
+}
+
+// SetPrice 设置当前模型的价格，用于计算每轮与整个会话的费用
+func (a *Agent) SetPrice(p Price) {
+	a.price = &p
+}
+
+// HasPrice 返回是否配置了价格
+func (a *Agent) HasPrice() bool {
+	return a.price != nil
+}
+
+// LastTurnUsage 返回最近一轮对话（可能包含多次模型请求）的用量
+func (a *Agent) LastTurnUsage() UsageStats {
+	return a.turnUsage
+}
+
+// SessionUsage 返回整个会话累计的用量
+func (a *Agent) SessionUsage() UsageStats {
+	return a.sessionUsage
+}
+
+// recordUsage 记录一次模型请求的用量，同时计入本轮与会话统计
+func (a *Agent) recordUsage(u model.Usage) {
+	var cost float64
+	if a.price != nil {
+		cost = a.price.Cost(u)
+	}
+	a.turnUsage.add(u, cost)
+	a.sessionUsage.add(u, cost)
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -10,23 +11,127 @@ type Config struct {
 	Model   ModelConfig   `yaml:"model"`
 	Context ContextConfig `yaml:"context"`
 	Tools   ToolsConfig   `yaml:"tools"`
+	Pricing PricingConfig `yaml:"pricing"`
+
+	// MCPServers 是 tools.mode 为 mcp 时要连接的 MCP 服务器，以服务器名为键
+	// 服务器名用于区分多个服务器中同名的工具（例如 "fs__read_file"）
+	// Load 会把 mcpServers 与 mcp_config_files 中的服务器合并进来，并去掉 disabled 的服务器
+	MCPServers map[string]MCPServerConfig `yaml:"mcp_servers"`
+
+	// EmbeddedMCPServers 是直接粘贴进 YAML 的 Claude Desktop 格式 "mcpServers" 块（JSON 也是合法的 YAML）
+	EmbeddedMCPServers map[string]MCPServerConfig `yaml:"mcpServers"`
+	// MCPConfigFiles 是 Claude Desktop（claude_desktop_config.json）或 VS Code（mcp.json）格式的 JSON 配置文件
+	MCPConfigFiles []string `yaml:"mcp_config_files"`
+}
+
+// MCPServerConfig 描述如何连接一个 MCP 服务器，字段与 Claude Desktop / VS Code 的 mcpServers 条目一致
+// 设置了 url 的服务器通过 HTTP 连接，否则启动 command 指定的 stdio 子进程
+type MCPServerConfig struct {
+	Type     string `yaml:"type" json:"type"`         // "stdio"、"http"（自动识别 Streamable HTTP 与旧版 HTTP+SSE）或 "sse"（仅旧版 HTTP+SSE），为空时根据是否设置了 url 判断
+	Disabled bool   `yaml:"disabled" json:"disabled"` // 为 true 时不启动该服务器
+
+	// stdio 服务器
+	Command string            `yaml:"command" json:"command"` // 服务器可执行文件，或 npx、uvx 等启动器
+	Args    []string          `yaml:"args" json:"args"`
+	Env     map[string]string `yaml:"env" json:"env"` // 在继承当前环境变量的基础上附加或覆盖
+	Cwd     string            `yaml:"cwd" json:"cwd"` // 工作目录，为空时使用当前目录
+
+	// 启动并完成握手的最长时间，默认 30s；npx、uvx 首次运行需要下载依赖时可适当调大
+	StartupTimeout time.Duration `yaml:"startup_timeout" json:"-"`
+	// 服务器 stderr 输出的去向：为空时丢弃，"stderr" 时加上服务器名前缀转发到本进程的 stderr，其他值作为日志文件路径追加写入
+	StderrLog string `yaml:"stderr_log" json:"-"`
+	// 调用因服务器进程退出而失败时，错误信息中附带的最近 stderr 行数，默认 20
+	StderrLines int `yaml:"stderr_lines" json:"-"`
+	// 进程退出后的重启策略："never"、"on-failure"（默认，仅异常退出时重启）或 "always"
+	Restart     string `yaml:"restart" json:"-"`
+	MaxRestarts int    `yaml:"max_restarts" json:"-"` // 连续重启的次数上限，默认 5
+	// 发送 ping 检查服务器是否无响应的间隔，默认 30s，设为负值则不检查
+	HealthCheckInterval time.Duration `yaml:"health_check_interval" json:"-"`
+
+	// 远程服务器（Streamable HTTP 或旧版 HTTP+SSE）
+	// 以上各字段与 url、headers 中的 ${VAR}、${VAR:-默认值} 会在加载时展开为环境变量的值
+	URL     string            `yaml:"url" json:"url"`         // MCP 端点地址，例如 "https://example.com/mcp" 或 "https://example.com/sse"
+	Headers map[string]string `yaml:"headers" json:"headers"` // 附加的请求头，例如 Authorization
+}
+
+// Transport 返回连接该服务器使用的传输方式："stdio"、"http" 或 "sse"
+func (s MCPServerConfig) Transport() string {
+	if s.Type != "" {
+		return s.Type
+	}
+	if s.URL != "" {
+		return "http"
+	}
+	return "stdio"
 }
 
 type ModelConfig struct {
-	APIKey      string  `yaml:"api_key"`
-	Provider    string  `yaml:"provider"`
-	ModelName   string  `yaml:"model_name"`
-	Temperature float32 `yaml:"temperature"`
-	MaxTokens   int     `yaml:"max_tokens"`
+	APIKey       string            `yaml:"api_key"`
+	Provider     string            `yaml:"provider"`     // deepseek、openai、openai_compatible、anthropic、ollama
+	BaseURL      string            `yaml:"base_url"`     // 接口基础地址，例如 "http://localhost:8000/v1"
+	Organization string            `yaml:"organization"` // OpenAI 组织 ID，可选
+	Headers      map[string]string `yaml:"headers"`      // 附加的自定义请求头，可选
+	ModelName    string            `yaml:"model_name"`
+	Stream       bool              `yaml:"stream"`    // 是否以流式方式输出模型回复
+	ToolMode     string            `yaml:"tool_mode"` // native（原生工具调用）或 prompt（基于提示词的工具调用）
+
+	// 采样参数，配置文件中未出现的字段不会发送给模型；指针字段用于区分未设置与显式设置的 0（例如 temperature: 0）
+	Temperature      *float64 `yaml:"temperature"` // 未设置时默认为 0.7
+	MaxTokens        int      `yaml:"max_tokens"`
+	TopP             *float64 `yaml:"top_p"`
+	Stop             []string `yaml:"stop"`
+	PresencePenalty  *float64 `yaml:"presence_penalty"`
+	FrequencyPenalty *float64 `yaml:"frequency_penalty"`
+	Seed             *int     `yaml:"seed"`
+	ResponseFormat   string   `yaml:"response_format"` // "text" 或 "json_object"
+
+	Retry RetryConfig `yaml:"retry"`
+}
+
+// RetryConfig 描述模型请求遇到限流、5xx、网络错误等临时性故障时的重试策略
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts"`    // 最大尝试次数（含首次请求），1 表示不重试
+	InitialBackoff time.Duration `yaml:"initial_backoff"` // 首次重试前的基础等待时间，例如 "1s"
+	MaxBackoff     time.Duration `yaml:"max_backoff"`     // 单次等待时间的上限
+	MaxElapsed     time.Duration `yaml:"max_elapsed"`     // 所有尝试的总期限
+}
+
+// PricingConfig 描述各模型的价格表，用于统计每轮与整个会话的费用
+type PricingConfig struct {
+	Currency string                 `yaml:"currency"` // 显示用的货币符号，默认 "$"
+	Models   map[string]PriceConfig `yaml:"models"`   // 以 model_name 为键
+}
+
+// PriceConfig 描述一个模型每百万 token 的价格
+type PriceConfig struct {
+	Prompt       float64 `yaml:"prompt"`        // 未命中缓存的输入
+	Completion   float64 `yaml:"completion"`    // 输出
+	CachedPrompt float64 `yaml:"cached_prompt"` // 命中缓存的输入，未设置时按 prompt 计价
 }
 
 type ContextConfig struct {
 	MaxHistory int `yaml:"max_history"`
+
+	// 基于 token 预算的历史裁剪，max_tokens 为 0 时只按 max_history 裁剪
+	MaxTokens           int `yaml:"max_tokens"`             // 模型的上下文窗口大小
+	ReserveTokens       int `yaml:"reserve_tokens"`         // 为模型回复预留的 token 数，默认等于 model.max_tokens
+	MaxToolResultTokens int `yaml:"max_tool_result_tokens"` // 单个工具结果的 token 上限，超出部分被截断，0 表示不截断
+
+	// 对话压缩：历史超过阈值时调用模型把较早的对话总结为固定保留的摘要消息
+	CompactEnabled    bool   `yaml:"compact_enabled"`
+	CompactThreshold  int    `yaml:"compact_threshold"`   // 触发自动压缩的历史 token 数，默认为 max_tokens 的 3/4
+	CompactKeepRecent int    `yaml:"compact_keep_recent"` // 压缩时原样保留的最近消息数（工具调用及其结果算一条），为 0 时使用 agent.DefaultKeepRecent
+	SummaryPrompt     string `yaml:"summary_prompt"`      // 生成摘要的提示词，为空时使用 agent.DefaultSummaryPrompt
 }
 
 type ToolsConfig struct {
 	Enabled bool   `yaml:"enabled"`
 	Mode    string `yaml:"mode"`
+
+	// 模型在一轮中返回多个工具调用时的执行方式
+	MaxParallel int           `yaml:"max_parallel"` // 同时执行的工具调用数上限，默认 4，设为 1 则逐个执行
+	CallTimeout time.Duration `yaml:"call_timeout"` // 单次工具调用的超时时间，默认 60s
+	Sequential  []string      `yaml:"sequential"`   // 不与其他调用并行执行的工具名称
 }
 
 func Load() (*Config, error) {
@@ -43,8 +148,9 @@ func Load() (*Config, error) {
 	if cfg.Context.MaxHistory <= 0 {
 		cfg.Context.MaxHistory = 20
 	}
-	if cfg.Model.Temperature == 0 {
-		cfg.Model.Temperature = 0.7
+	if cfg.Model.Temperature == nil {
+		temperature := 0.7
+		cfg.Model.Temperature = &temperature
 	}
 	if cfg.Model.MaxTokens == 0 {
 		cfg.Model.MaxTokens = 1024
@@ -52,9 +158,46 @@ func Load() (*Config, error) {
 	if cfg.Model.Provider == "" {
 		cfg.Model.Provider = "deepseek"
 	}
-	if cfg.Model.ModelName == "" {
+	if cfg.Model.Retry.MaxAttempts <= 0 {
+		cfg.Model.Retry.MaxAttempts = 3
+	}
+	if cfg.Model.Retry.InitialBackoff <= 0 {
+		cfg.Model.Retry.InitialBackoff = time.Second
+	}
+	if cfg.Model.Retry.MaxBackoff <= 0 {
+		cfg.Model.Retry.MaxBackoff = 30 * time.Second
+	}
+	if cfg.Model.Retry.MaxElapsed <= 0 {
+		cfg.Model.Retry.MaxElapsed = 2 * time.Minute
+	}
+	if cfg.Context.MaxTokens > 0 && cfg.Context.ReserveTokens <= 0 {
+		cfg.Context.ReserveTokens = cfg.Model.MaxTokens
+	}
+	if cfg.Context.CompactThreshold <= 0 {
+		if cfg.Context.MaxTokens > 0 {
+			cfg.Context.CompactThreshold = cfg.Context.MaxTokens * 3 / 4
+		} else {
+			cfg.Context.CompactThreshold = 8000
+		}
+	}
+	if cfg.Pricing.Currency == "" {
+		cfg.Pricing.Currency = "$"
+	}
+	if cfg.Tools.MaxParallel <= 0 {
+		cfg.Tools.MaxParallel = 4
+	}
+	if cfg.Tools.CallTimeout <= 0 {
+		cfg.Tools.CallTimeout = 60 * time.Second
+	}
+	if cfg.Model.ToolMode == "" {
+		cfg.Model.ToolMode = "native"
+	}
+	if cfg.Model.ModelName == "" && cfg.Model.Provider == "deepseek" {
 		cfg.Model.ModelName = "deepseek-chat"
 	}
+	if err := cfg.mergeMCPServers(); err != nil {
+		return nil, err
+	}
 
 	return &cfg, nil
 }
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultMCPServerCommand 是未配置任何 MCP 服务器时启动的自带服务器（由 build.sh 构建）
+const DefaultMCPServerCommand = "./cmd/mcp_server_local/mcp-server-local"
+
+// mcpServersFile 是 JSON 格式的 MCP 服务器配置文件：
+// Claude Desktop 使用 "mcpServers" 键，VS Code 的 mcp.json 使用 "servers" 键
+type mcpServersFile struct {
+	MCPServers map[string]MCPServerConfig `json:"mcpServers"`
+	Servers    map[string]MCPServerConfig `json:"servers"`
+}
+
+// LoadMCPServersJSON 读取 Claude Desktop / VS Code 格式的 JSON 配置文件，返回其中的 MCP 服务器
+// 路径以 "~/" 开头时相对于用户主目录
+func LoadMCPServersJSON(path string) (map[string]MCPServerConfig, error) {
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+		}
+		path = filepath.Join(home, path[2:])
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MCP config file: %w", err)
+	}
+	return ParseMCPServersJSON(data)
+}
+
+// ParseMCPServersJSON 解析 JSON 格式的 MCP 服务器配置，既接受带有 "mcpServers"/"servers" 键的完整文件，
+// 也接受只包含服务器映射的片段（即 mcpServers 的值本身）
+// 没有这两个键、且并非每个值都是服务器配置的文件（例如只有 globalShortcut 的 claude_desktop_config.json）视为没有配置服务器
+func ParseMCPServersJSON(data []byte) (map[string]MCPServerConfig, error) {
+	var file mcpServersFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse MCP config JSON: %w", err)
+	}
+
+	servers := make(map[string]MCPServerConfig)
+	if file.MCPServers != nil || file.Servers != nil {
+		for name, srv := range file.Servers {
+			servers[name] = srv
+		}
+		for name, srv := range file.MCPServers {
+			servers[name] = srv
+		}
+		return servers, nil
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse MCP config JSON: %w", err)
+	}
+	for name, raw := range values {
+		srv, ok := decodeServerObject(raw)
+		if !ok {
+			return map[string]MCPServerConfig{}, nil
+		}
+		servers[name] = srv
+	}
+	return servers, nil
+}
+
+// decodeServerObject 将 raw 解析为服务器配置，raw 不是设置了 command 或 url 的 JSON 对象时返回 false
+func decodeServerObject(raw json.RawMessage) (MCPServerConfig, bool) {
+	var srv MCPServerConfig
+	if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) || json.Unmarshal(raw, &srv) != nil {
+		return MCPServerConfig{}, false
+	}
+	return srv, srv.Command != "" || srv.URL != ""
+}
+
+// mergeMCPServers 合并各个来源的 MCP 服务器并去掉 disabled 的服务器
+// 同名时优先级从高到低为：mcp_servers、mcpServers、mcp_config_files（列表中靠后的文件优先）
+func (cfg *Config) mergeMCPServers() error {
+	merged := make(map[string]MCPServerConfig)
+	for _, path := range cfg.MCPConfigFiles {
+		servers, err := LoadMCPServersJSON(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for name, srv := range servers {
+			merged[name] = srv
+		}
+	}
+	for name, srv := range cfg.EmbeddedMCPServers {
+		merged[name] = srv
+	}
+	for name, srv := range cfg.MCPServers {
+		merged[name] = srv
+	}
+
+	// 只有完全没有配置服务器时才使用自带的本地服务器；全部服务器都被 disabled 时尊重用户的选择，不启动任何服务器
+	if len(merged) == 0 {
+		merged["local"] = MCPServerConfig{Command: DefaultMCPServerCommand}
+	}
+	for name, srv := range merged {
+		if srv.Disabled {
+			delete(merged, name)
+			continue
+		}
+		merged[name] = srv.expand()
+	}
+	cfg.MCPServers = merged
+	return nil
+}
+
+// varPattern 匹配 ${VAR} 与 ${VAR:-默认值}
+var varPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandVars 将 s 中的 ${VAR} 替换为 lookup 返回的值，未定义时替换为 ":-" 后的默认值或空串
+// 只识别带花括号的形式，参数中单独出现的 "$" 保持原样
+func expandVars(s string, lookup func(string) (string, bool)) string {
+	return varPattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := varPattern.FindStringSubmatch(m)
+		if v, ok := lookup(sub[1]); ok {
+			return v
+		}
+		return sub[3]
+	})
+}
+
+// expand 展开服务器配置中的 ${VAR}：env 的值按当前进程的环境变量展开，
+// command、args、cwd、stderr_log、url 与 headers 优先使用该服务器 env 中的变量，其次是当前进程的环境变量
+func (s MCPServerConfig) expand() MCPServerConfig {
+	env := make(map[string]string, len(s.Env))
+	for k, v := range s.Env {
+		env[k] = expandVars(v, os.LookupEnv)
+	}
+	lookup := func(name string) (string, bool) {
+		if v, ok := env[name]; ok {
+			return v, true
+		}
+		return os.LookupEnv(name)
+	}
+
+	out := s
+	if len(env) > 0 {
+		out.Env = env
+	}
+	out.Command = expandVars(s.Command, lookup)
+	out.Args = make([]string, len(s.Args))
+	for i, arg := range s.Args {
+		out.Args[i] = expandVars(arg, lookup)
+	}
+	out.Cwd = expandVars(s.Cwd, lookup)
+	out.StderrLog = expandVars(s.StderrLog, lookup)
+	out.URL = expandVars(s.URL, lookup)
+	if len(s.Headers) > 0 {
+		out.Headers = make(map[string]string, len(s.Headers))
+		for k, v := range s.Headers {
+			out.Headers[k] = expandVars(v, lookup)
+		}
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeMCPServersDefaultsToLocalServer(t *testing.T) {
+	var cfg Config
+	if err := cfg.mergeMCPServers(); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.MCPServers) != 1 || cfg.MCPServers["local"].Command != DefaultMCPServerCommand {
+		t.Fatalf("got %+v, want only the bundled local server", cfg.MCPServers)
+	}
+}
+
+func TestMergeMCPServersRespectsDisabled(t *testing.T) {
+	cfg := Config{
+		MCPServers: map[string]MCPServerConfig{
+			"fs":  {Command: "npx", Disabled: true},
+			"git": {Command: "uvx", Disabled: true},
+		},
+	}
+	if err := cfg.mergeMCPServers(); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.MCPServers) != 0 {
+		t.Fatalf("got %+v, want no servers when every server is disabled", cfg.MCPServers)
+	}
+}
+
+func TestMergeMCPServersPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "claude_desktop_config.json")
+	data := `{"mcpServers": {
+		"a": {"command": "from-file"},
+		"b": {"command": "from-file"},
+		"c": {"command": "from-file", "disabled": true}
+	}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		MCPConfigFiles:     []string{path},
+		EmbeddedMCPServers: map[string]MCPServerConfig{"b": {Command: "embedded"}},
+		MCPServers:         map[string]MCPServerConfig{"a": {Command: "${MCP_TEST_CMD:-native}"}},
+	}
+	if err := cfg.mergeMCPServers(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"a": "native", "b": "embedded"}
+	if len(cfg.MCPServers) != len(want) {
+		t.Fatalf("got %+v", cfg.MCPServers)
+	}
+	for name, command := range want {
+		if got := cfg.MCPServers[name].Command; got != command {
+			t.Errorf("%s: command = %q, want %q", name, got, command)
+		}
+	}
+}
+
+func TestParseMCPServersJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]string // 服务器名 -> command 或 url
+	}{
+		{"mcpServers key", `{"mcpServers": {"fs": {"command": "npx"}}, "globalShortcut": "Ctrl+Space"}`, map[string]string{"fs": "npx"}},
+		{"servers key", `{"servers": {"remote": {"type": "http", "url": "https://example.com/mcp"}}}`, map[string]string{"remote": "https://example.com/mcp"}},
+		{"bare server map", `{"fs": {"command": "npx"}, "remote": {"url": "https://example.com/mcp"}}`,
+			map[string]string{"fs": "npx", "remote": "https://example.com/mcp"}},
+		{"desktop settings only", `{"globalShortcut": "Ctrl+Space"}`, map[string]string{}},
+		{"settings object only", `{"preferences": {"theme": "dark"}}`, map[string]string{}},
+		{"servers mixed with settings", `{"fs": {"command": "npx"}, "globalShortcut": "Ctrl+Space"}`, map[string]string{}},
+		{"empty object", `{}`, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers, err := ParseMCPServersJSON([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if servers == nil || len(servers) != len(tt.want) {
+				t.Fatalf("got %+v, want %d servers", servers, len(tt.want))
+			}
+			for name, target := range tt.want {
+				if srv := servers[name]; srv.Command+srv.URL != target {
+					t.Errorf("%s = %+v, want %s", name, srv, target)
+				}
+			}
+		})
+	}
+
+	if _, err := ParseMCPServersJSON([]byte(`{"mcpServers":`)); err == nil {
+		t.Error("invalid JSON parsed without error")
+	}
+}
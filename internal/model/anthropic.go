@@ -0,0 +1,441 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/config"
+	"github.com/windlant/mcp-client/internal/protocol"
+)
+
+const (
+	// DefaultAnthropicBaseURL 是 Anthropic API 的默认地址
+	DefaultAnthropicBaseURL = "https://api.anthropic.com"
+	// anthropicVersion 是请求头 anthropic-version 的取值
+	anthropicVersion = "2023-06-01"
+)
+
+// AnthropicModel 是对接 Anthropic Messages API 的模型实现
+type AnthropicModel struct {
+	baseURL      string
+	apiKey       string
+	headers      map[string]string // 附加的自定义请求头
+	modelName    string
+	defaults     ChatOptions // 来自配置的默认采样参数
+	retry        RetryPolicy // 临时性错误的重试策略
+	httpClient   *http.Client
+	streamClient *http.Client // 流式请求专用，不设置整体超时
+}
+
+// NewAnthropicModel 根据配置创建 Anthropic 模型实例
+func NewAnthropicModel(cfg *config.Config) (Model, error) {
+	if cfg.Model.APIKey == "" {
+		return nil, fmt.Errorf("Anthropic API key is required")
+	}
+	if cfg.Model.ModelName == "" {
+		return nil, fmt.Errorf("model_name is required for provider %q", cfg.Model.Provider)
+	}
+	baseURL := cfg.Model.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultAnthropicBaseURL
+	}
+	return &AnthropicModel{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		apiKey:    cfg.Model.APIKey,
+		headers:   cfg.Model.Headers,
+		modelName: cfg.Model.ModelName,
+		defaults:  OptionsFromConfig(cfg.Model),
+		retry:     RetryPolicyFromConfig(cfg.Model.Retry),
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+		streamClient: &http.Client{},
+	}, nil
+}
+
+// anthropicMessage 是 Messages API 中的一条消息，内容统一使用内容块数组
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+// anthropicContentBlock 是消息中的一个内容块（text、tool_use 或 tool_result）
+type anthropicContentBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"` // 工具调用失败
+}
+
+// anthropicTool 是 Messages API 所期望的工具格式
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// convertMessagesToAnthropic 将内部消息转换为 Messages API 的格式
+// - system 消息被提取出来，拼接后作为顶层 system 字段
+// - 助手的 ToolCalls 转换为 tool_use 内容块
+// - role 为 "tool" 的消息转换为 user 消息中的 tool_result 内容块
+// - 连续的同角色消息合并为一条，满足 API 对角色交替的要求
+// - 裁剪后的历史可能以助手消息开头，API 要求第一条消息必须来自用户，此时在最前面插入一条占位的用户消息
+func convertMessagesToAnthropic(messages []protocol.Message) (string, []anthropicMessage) {
+	var systemParts []string
+	var out []anthropicMessage
+
+	appendBlocks := func(role string, blocks ...anthropicContentBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(out); n > 0 && out[n-1].Role == role {
+			out[n-1].Content = append(out[n-1].Content, blocks...)
+			return
+		}
+		out = append(out, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				systemParts = append(systemParts, msg.Content)
+			}
+
+		case "assistant":
+			var blocks []anthropicContentBlock
+			// "{}" 是工具调用时的占位内容，不应作为文本发送
+			if msg.Content != "" && !(msg.Content == "{}" && len(msg.ToolCalls) > 0) {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				input := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(input) || len(bytes.TrimSpace(input)) == 0 {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicContentBlock{
+					Type:  "tool_use",
+					ID:    tc.ID,
+					Name:  tc.Function.Name,
+					Input: input,
+				})
+			}
+			appendBlocks("assistant", blocks...)
+
+		case "tool":
+			appendBlocks("user", anthropicContentBlock{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Content,
+				IsError:   msg.IsError,
+			})
+
+		default:
+			if msg.Content != "" {
+				appendBlocks("user", anthropicContentBlock{Type: "text", Text: msg.Content})
+			}
+		}
+	}
+
+	if len(out) > 0 && out[0].Role == "assistant" {
+		placeholder := anthropicMessage{
+			Role:    "user",
+			Content: []anthropicContentBlock{{Type: "text", Text: earlierConversationPlaceholder}},
+		}
+		out = append([]anthropicMessage{placeholder}, out...)
+	}
+
+	return strings.Join(systemParts, "\n\n"), out
+}
+
+// earlierConversationPlaceholder 是历史以助手消息开头时插入的用户消息内容
+const earlierConversationPlaceholder = "(Earlier conversation omitted.)"
+
+// convertToolsToAnthropic 将 OpenAI 风格的工具定义转换为 Anthropic 的 input_schema 格式
+func convertToolsToAnthropic(tools []ToolForAPI) []anthropicTool {
+	out := make([]anthropicTool, len(tools))
+	for i, t := range tools {
+		schema := t.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		out[i] = anthropicTool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: schema,
+		}
+	}
+	return out
+}
+
+// newRequest 构造发往 /v1/messages 的 HTTP 请求
+func (a *AnthropicModel) newRequest(ctx context.Context, messages []protocol.Message, tools []ToolForAPI, opts *ChatOptions, stream bool) (*http.Request, error) {
+	system, msgs := convertMessagesToAnthropic(messages)
+
+	// Messages API 要求必须提供 max_tokens
+	merged := a.defaults.Merge(opts)
+	maxTokens := 1024
+	if merged.MaxTokens != nil {
+		maxTokens = *merged.MaxTokens
+	}
+
+	reqBody := map[string]interface{}{
+		"model":      a.modelName,
+		"messages":   msgs,
+		"max_tokens": maxTokens,
+		"stream":     stream,
+	}
+	if system != "" {
+		reqBody["system"] = system
+	}
+	if len(tools) > 0 {
+		reqBody["tools"] = convertToolsToAnthropic(tools)
+	}
+
+	// Messages API 不支持 penalty、seed 与 response_format，这些参数会被忽略
+	if merged.Temperature != nil {
+		reqBody["temperature"] = *merged.Temperature
+	}
+	if merged.TopP != nil {
+		reqBody["top_p"] = *merged.TopP
+	}
+	if len(merged.Stop) > 0 {
+		reqBody["stop_sequences"] = merged.Stop
+	}
+
+	bodyBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/v1/messages", bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", a.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	for k, v := range a.headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// Chat 发送普通对话消息（不使用工具），返回模型的文本回复
+func (a *AnthropicModel) Chat(ctx context.Context, messages []protocol.Message) (string, error) {
+	content, _, _, err := a.ChatWithTools(ctx, messages, nil, nil)
+	return content, err
+}
+
+// ChatWithTools 发送支持工具调用的对话请求，返回文本内容和工具调用列表
+func (a *AnthropicModel) ChatWithTools(ctx context.Context, messages []protocol.Message, tools []ToolForAPI, opts *ChatOptions) (string, []protocol.ToolCall, Usage, error) {
+	resp, err := doWithRetry(ctx, a.httpClient, a.retry, "Anthropic", func(ctx context.Context) (*http.Request, error) {
+		return a.newRequest(ctx, messages, tools, opts, false)
+	})
+	if err != nil {
+		return "", nil, Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, Usage{}, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var apiResp struct {
+		Content []anthropicContentBlock `json:"content"`
+		Usage   anthropicUsage          `json:"usage"`
+	}
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return "", nil, Usage{}, fmt.Errorf("failed to parse Anthropic response: %w", err)
+	}
+
+	var text strings.Builder
+	var toolCalls []protocol.ToolCall
+	for _, block := range apiResp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			args := string(block.Input)
+			if args == "" {
+				args = "{}"
+			}
+			toolCalls = append(toolCalls, protocol.ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: protocol.Function{Name: block.Name, Arguments: args},
+			})
+		}
+	}
+
+	content := text.String()
+	if content == "" && len(toolCalls) > 0 {
+		content = "{}" // 占位符；实际关注的是 ToolCalls
+	}
+
+	return content, toolCalls, apiResp.Usage.toUsage(), nil
+}
+
+// anthropicUsage 是 Messages API 返回的用量
+// input_tokens 不包含读写缓存的部分，需要加上缓存相关的 token 才是完整的输入量
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// toUsage 转换为统一的 Usage
+func (u anthropicUsage) toUsage() Usage {
+	return Usage{
+		PromptTokens:       u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		CompletionTokens:   u.OutputTokens,
+		CachedPromptTokens: u.CacheReadInputTokens,
+	}
+}
+
+// anthropicStreamEvent 是 Messages API 流式响应中的一个事件
+type anthropicStreamEvent struct {
+	Type         string                `json:"type"`
+	Index        int                   `json:"index"`
+	ContentBlock anthropicContentBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"` // message_start 事件携带输入用量
+	Usage anthropicUsage `json:"usage"` // message_delta 事件携带累计的输出用量
+}
+
+// anthropicErrorStatus 是 Anthropic 错误类型对应的 HTTP 状态码
+var anthropicErrorStatus = map[string]int{
+	"invalid_request_error": http.StatusBadRequest,
+	"authentication_error":  http.StatusUnauthorized,
+	"permission_error":      http.StatusForbidden,
+	"not_found_error":       http.StatusNotFound,
+	"request_too_large":     http.StatusRequestEntityTooLarge,
+	"rate_limit_error":      http.StatusTooManyRequests,
+	"api_error":             http.StatusInternalServerError,
+	"overloaded_error":      529,
+}
+
+// anthropicStreamError 将流中途的 error 事件转换为 APIError，按错误类型对应的状态码分类，与 HTTP 错误响应一致
+// 未知的错误类型按服务端错误处理
+func anthropicStreamError(errType string, data []byte) *APIError {
+	status, ok := anthropicErrorStatus[errType]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	return newAPIError("Anthropic", status, data, nil)
+}
+
+// ChatStream 以流式方式发送支持工具调用的对话请求
+// 文本增量通过 onDelta 实时回调，tool_use 的 input_json_delta 在内部拼接完整后随返回值一并给出
+func (a *AnthropicModel) ChatStream(ctx context.Context, messages []protocol.Message, tools []ToolForAPI, opts *ChatOptions, onDelta StreamHandler) (string, []protocol.ToolCall, Usage, error) {
+	// 重试只发生在收到响应之前，开始接收数据后出错不再重试
+	resp, err := doWithRetry(ctx, a.streamClient, a.retry, "Anthropic", func(ctx context.Context) (*http.Request, error) {
+		req, err := a.newRequest(ctx, messages, tools, opts, true)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		return req, nil
+	})
+	if err != nil {
+		return "", nil, Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var usage anthropicUsage
+	stopped := false // 是否收到了 message_stop
+	acc := newToolCallAccumulator()
+
+	err = readSSE(resp.Body, func(data []byte) error {
+		var ev anthropicStreamEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return fmt.Errorf("failed to parse stream event: %w", err)
+		}
+
+		switch ev.Type {
+		case "message_start":
+			usage = ev.Message.Usage
+		case "message_delta":
+			usage.OutputTokens = ev.Usage.OutputTokens
+		case "message_stop":
+			stopped = true
+		case "content_block_start":
+			if ev.ContentBlock.Type == "tool_use" {
+				d := toolCallDelta{Index: ev.Index, ID: ev.ContentBlock.ID, Type: "function"}
+				d.Function.Name = ev.ContentBlock.Name
+				acc.add(d)
+			}
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				text.WriteString(ev.Delta.Text)
+				if onDelta != nil {
+					onDelta(ev.Delta.Text)
+				}
+			case "input_json_delta":
+				d := toolCallDelta{Index: ev.Index}
+				d.Function.Arguments = ev.Delta.PartialJSON
+				acc.add(d)
+			}
+		case "error":
+			return anthropicStreamError(ev.Error.Type, data)
+		}
+		return nil
+	})
+	if errors.Is(err, io.ErrUnexpectedEOF) && stopped {
+		// Messages API 的流以 message_stop 事件结束，不发送 [DONE]
+		err = nil
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", nil, Usage{}, fmt.Errorf("stream ended before message_stop: %w", err)
+	}
+	if err != nil {
+		return "", nil, Usage{}, err
+	}
+
+	toolCalls := acc.result()
+	for i := range toolCalls {
+		// 没有参数的工具调用不会产生 input_json_delta
+		if toolCalls[i].Function.Arguments == "" {
+			toolCalls[i].Function.Arguments = "{}"
+		}
+	}
+
+	content := text.String()
+	if content == "" && len(toolCalls) > 0 {
+		content = "{}" // 与非流式接口保持一致的占位符
+	}
+
+	return content, toolCalls, usage.toUsage(), nil
+}
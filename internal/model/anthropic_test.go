@@ -0,0 +1,245 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/windlant/mcp-client/internal/config"
+	"github.com/windlant/mcp-client/internal/protocol"
+)
+
+func TestConvertMessagesMarksFailedToolResults(t *testing.T) {
+	_, out := convertMessagesToAnthropic([]protocol.Message{
+		{Role: "user", Content: "what time is it in two zones?"},
+		{Role: "assistant", ToolCalls: []protocol.ToolCall{
+			{ID: "a", Type: "function", Function: protocol.Function{Name: "get_current_time", Arguments: `{"tz":"UTC"}`}},
+			{ID: "b", Type: "function", Function: protocol.Function{Name: "get_current_time", Arguments: `{"tz":"Nowhere"}`}},
+		}},
+		{Role: "tool", ToolCallID: "a", Content: "12:00"},
+		{Role: "tool", ToolCallID: "b", Content: "Error: unknown time zone", IsError: true},
+	})
+
+	if len(out) != 3 || out[2].Role != "user" || len(out[2].Content) != 2 {
+		t.Fatalf("unexpected conversion: %+v", out)
+	}
+	if ok := out[2].Content[0]; ok.Type != "tool_result" || ok.ToolUseID != "a" || ok.IsError {
+		t.Errorf("successful result: %+v", ok)
+	}
+	if failed := out[2].Content[1]; failed.Type != "tool_result" || failed.ToolUseID != "b" || !failed.IsError {
+		t.Errorf("failed result: %+v", failed)
+	}
+}
+
+func TestConvertMessagesStartsWithUserTurn(t *testing.T) {
+	// 裁剪后第一条非 system 消息是助手回复
+	system, out := convertMessagesToAnthropic([]protocol.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "assistant", ToolCalls: []protocol.ToolCall{
+			{ID: "a", Type: "function", Function: protocol.Function{Name: "get_current_time", Arguments: "{}"}},
+		}},
+		{Role: "tool", ToolCallID: "a", Content: "12:00"},
+		{Role: "assistant", Content: "It is noon."},
+		{Role: "user", Content: "thanks"},
+	})
+
+	if system != "sys" {
+		t.Fatalf("system = %q", system)
+	}
+	if len(out) != 5 || out[0].Role != "user" || out[0].Content[0].Text != earlierConversationPlaceholder {
+		t.Fatalf("expected a placeholder user turn first, got %+v", out)
+	}
+	for i := 1; i < len(out); i++ {
+		if out[i].Role == out[i-1].Role {
+			t.Fatalf("roles do not alternate at %d: %+v", i, out)
+		}
+	}
+	if out[1].Content[0].Type != "tool_use" || out[2].Content[0].Type != "tool_result" {
+		t.Fatalf("tool round changed: %+v", out)
+	}
+
+	// 以用户消息开头的历史保持不变
+	_, out = convertMessagesToAnthropic([]protocol.Message{{Role: "user", Content: "hi"}})
+	if len(out) != 1 || out[0].Content[0].Text != "hi" {
+		t.Fatalf("got %+v", out)
+	}
+}
+
+// newTestAnthropic 创建连接到 handler 的 Anthropic 模型
+func newTestAnthropic(t *testing.T, handler http.HandlerFunc) Model {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("unexpected request %s with headers %v", r.URL.Path, r.Header)
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	m, err := NewAnthropicModel(&config.Config{Model: config.ModelConfig{
+		Provider:  "anthropic",
+		APIKey:    "test-key",
+		ModelName: "claude-test",
+		BaseURL:   srv.URL,
+		Retry:     config.RetryConfig{MaxAttempts: 1},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// anthropicEvents 返回以 SSE 格式依次写出 events 的处理函数，每个事件的 event 名称取自其 type 字段
+func anthropicEvents(events ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, data := range events {
+			var ev struct {
+				Type string `json:"type"`
+			}
+			_ = json.Unmarshal([]byte(data), &ev)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		}
+	}
+}
+
+func TestAnthropicToolUseResponse(t *testing.T) {
+	m := newTestAnthropic(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Stream bool              `json:"stream"`
+			Tools  []json.RawMessage `json:"tools"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Stream || len(req.Tools) != 1 {
+			t.Errorf("request = %+v, %v; want a non-streaming request with one tool", req, err)
+		}
+		_, _ = io.WriteString(w, `{
+			"content": [
+				{"type": "text", "text": "Checking."},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_time", "input": {"tz": "UTC"}},
+				{"type": "tool_use", "id": "toolu_2", "name": "get_time", "input": {}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 10, "cache_read_input_tokens": 5, "output_tokens": 7}
+		}`)
+	})
+
+	content, calls, usage, err := m.ChatWithTools(context.Background(), []protocol.Message{{Role: "user", Content: "time?"}}, timeTool, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Checking." {
+		t.Errorf("content = %q", content)
+	}
+	if len(calls) != 2 || calls[0].ID != "toolu_1" || calls[0].Function.Name != "get_time" || calls[0].Function.Arguments != `{"tz": "UTC"}` ||
+		calls[1].ID != "toolu_2" || calls[1].Function.Arguments != `{}` {
+		t.Errorf("tool calls = %+v", calls)
+	}
+	if usage.PromptTokens != 15 || usage.CachedPromptTokens != 5 || usage.CompletionTokens != 7 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestAnthropicStreamAccumulatesToolInput(t *testing.T) {
+	m := newTestAnthropic(t, anthropicEvents(
+		`{"type":"message_start","message":{"usage":{"input_tokens":12,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"check."}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_time","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"tz\": \"U"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"TC\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_2","name":"get_time","input":{}}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"ping"}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":30}}`,
+		`{"type":"message_stop"}`,
+	))
+
+	var deltas []string
+	content, calls, usage, err := m.ChatStream(context.Background(), []protocol.Message{{Role: "user", Content: "time?"}}, timeTool, nil,
+		func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Let me check." || len(deltas) != 2 {
+		t.Errorf("content = %q, deltas = %q", content, deltas)
+	}
+	if len(calls) != 2 || calls[0].ID != "toolu_1" || calls[0].Function.Arguments != `{"tz": "UTC"}` ||
+		calls[1].ID != "toolu_2" || calls[1].Function.Arguments != `{}` {
+		t.Errorf("tool calls = %+v", calls)
+	}
+	if usage.PromptTokens != 12 || usage.CompletionTokens != 30 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestAnthropicStreamErrors(t *testing.T) {
+	start := `{"type":"message_start","message":{"usage":{"input_tokens":12}}}`
+	text := `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me"}}`
+
+	tests := []struct {
+		name   string
+		events []string
+		kind   error
+		status int
+	}{
+		{
+			name:   "overloaded",
+			events: []string{start, text, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`},
+			kind:   ErrServerError,
+			status: 529,
+		},
+		{
+			name:   "rate limited",
+			events: []string{start, `{"type":"error","error":{"type":"rate_limit_error","message":"Too many requests"}}`},
+			kind:   ErrRateLimited,
+			status: http.StatusTooManyRequests,
+		},
+		{
+			name:   "prompt too long",
+			events: []string{`{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens"}}`},
+			kind:   ErrContextLengthExceeded,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown error type",
+			events: []string{start, `{"type":"error","error":{"type":"mystery_error","message":"?"}}`},
+			kind:   ErrServerError,
+			status: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestAnthropic(t, anthropicEvents(tt.events...))
+			_, _, _, err := m.ChatStream(context.Background(), []protocol.Message{{Role: "user", Content: "hi"}}, nil, nil, nil)
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || !errors.Is(err, tt.kind) {
+				t.Fatalf("error = %v, want an APIError of kind %v", err, tt.kind)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Provider != "Anthropic" {
+				t.Errorf("APIError = %+v, want status %d", apiErr, tt.status)
+			}
+		})
+	}
+}
+
+func TestAnthropicStreamEndsBeforeMessageStop(t *testing.T) {
+	m := newTestAnthropic(t, anthropicEvents(
+		`{"type":"message_start","message":{"usage":{"input_tokens":12}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me"}}`,
+	))
+	_, _, _, err := m.ChatStream(context.Background(), []protocol.Message{{Role: "user", Content: "hi"}}, nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "before message_stop") {
+		t.Fatalf("error = %v, want stream ended before message_stop", err)
+	}
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 模型接口错误的分类，可通过 errors.Is 判断具体类型
+var (
+	ErrRateLimited           = errors.New("rate limited")
+	ErrAuthFailed            = errors.New("authentication failed")
+	ErrContextLengthExceeded = errors.New("context length exceeded")
+	ErrBadRequest            = errors.New("bad request")
+	ErrServerError           = errors.New("server error")
+	ErrNetwork               = errors.New("network error")
+)
+
+// APIError 表示模型接口返回的非成功响应
+type APIError struct {
+	Provider   string        // 提供方名称，例如 "DeepSeek"
+	StatusCode int           // HTTP 状态码
+	Body       string        // 原始响应内容
+	Kind       error         // 错误分类，取值为上面定义的 Err* 之一
+	RetryAfter time.Duration // 服务端通过 Retry-After 建议的等待时间，未提供时为 0
+}
+
+// Error 实现 error 接口
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API error (%d): %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// Unwrap 返回错误分类，使 errors.Is(err, ErrRateLimited) 等判断成立
+func (e *APIError) Unwrap() error {
+	return e.Kind
+}
+
+// contextLengthMarkers 是各提供方在上下文超长时错误信息中常见的片段
+var contextLengthMarkers = []string{
+	"context_length_exceeded",
+	"maximum context length",
+	"context length",
+	"prompt is too long",
+	"too many tokens",
+}
+
+// newAPIError 根据状态码、响应内容与响应头构造分类后的 APIError
+func newAPIError(provider string, statusCode int, body []byte, header http.Header) *APIError {
+	e := &APIError{
+		Provider:   provider,
+		StatusCode: statusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(header),
+	}
+
+	lower := strings.ToLower(e.Body)
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		e.Kind = ErrRateLimited
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		e.Kind = ErrAuthFailed
+	case statusCode >= 500:
+		// 包括 Anthropic 过载时返回的 529
+		e.Kind = ErrServerError
+	case statusCode >= 400:
+		e.Kind = ErrBadRequest
+		for _, marker := range contextLengthMarkers {
+			if strings.Contains(lower, marker) {
+				e.Kind = ErrContextLengthExceeded
+				break
+			}
+		}
+	default:
+		e.Kind = ErrServerError
+	}
+	return e
+}
+
+// isRetryable 判断错误是否属于可以重试的临时性错误
+func isRetryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServerError) || errors.Is(err, ErrNetwork)
+}
@@ -1,6 +1,11 @@
 package model
 
-import "github.com/windlant/mcp-client/internal/protocol"
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+)
 
 // ToolForAPI 表示 LLM API（如 DeepSeek、OpenAI）所期望的工具格式
 type ToolForAPI struct {
@@ -10,20 +15,30 @@ type ToolForAPI struct {
 
 // ToolFuncDef 描述一个可调用的函数/工具
 type ToolFuncDef struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	Parameters  map[string]interface{} `json:"parameters"` // JSON Schema 对象
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"` // JSON Schema 对象
 }
 
 // Model 是所有大语言模型后端的统一接口
+// 所有方法都应在 ctx 被取消时尽快中止正在进行的请求并返回 ctx.Err()
 type Model interface {
 	// Chat 处理不使用工具的标准对话
-	Chat(messages []protocol.Message) (string, error)
+	Chat(ctx context.Context, messages []protocol.Message) (string, error)
 
 	// ChatWithTools 处理支持工具调用的对话
 	// 实现时应：
 	// - 如果模型支持，使用 'tools' 引导模型行为
 	// - 返回模型生成的 tool_calls
 	// - 对于不支持工具的模型，返回空的 toolCalls，并按普通对话处理
-	ChatWithTools(messages []protocol.Message, tools []ToolForAPI) (content string, toolCalls []protocol.ToolCall, err error)
+	// - opts 中已设置的采样参数覆盖配置中的默认值（opts 可以为 nil）
+	// - 返回本次请求的 token 用量；接口未提供用量时返回零值
+	ChatWithTools(ctx context.Context, messages []protocol.Message, tools []ToolForAPI, opts *ChatOptions) (content string, toolCalls []protocol.ToolCall, usage Usage, err error)
+
+	// ChatStream 是 ChatWithTools 的流式版本
+	// 实现时应：
+	// - 每收到一段文本增量即调用 onDelta（onDelta 可以为 nil）
+	// - 将分片到达的 tool_calls 拼接完整后随返回值一并给出
+	// - 返回值语义与 ChatWithTools 保持一致
+	ChatStream(ctx context.Context, messages []protocol.Message, tools []ToolForAPI, opts *ChatOptions, onDelta StreamHandler) (content string, toolCalls []protocol.ToolCall, usage Usage, err error)
 }
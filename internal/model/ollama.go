@@ -0,0 +1,292 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/config"
+	"github.com/windlant/mcp-client/internal/protocol"
+)
+
+// DefaultOllamaBaseURL 是本地 Ollama 服务的默认地址
+const DefaultOllamaBaseURL = "http://localhost:11434"
+
+// OllamaModel 是对接 Ollama /api/chat 接口的本地模型实现
+type OllamaModel struct {
+	baseURL      string
+	headers      map[string]string // 附加的自定义请求头
+	modelName    string
+	defaults     ChatOptions // 来自配置的默认采样参数
+	retry        RetryPolicy // 临时性错误的重试策略
+	httpClient   *http.Client
+	streamClient *http.Client // 流式请求专用，不设置整体超时
+}
+
+// NewOllamaModel 根据配置创建 Ollama 模型实例
+func NewOllamaModel(cfg *config.Config) (Model, error) {
+	if cfg.Model.ModelName == "" {
+		return nil, fmt.Errorf("model_name is required for provider %q", cfg.Model.Provider)
+	}
+	baseURL := cfg.Model.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultOllamaBaseURL
+	}
+	return &OllamaModel{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		headers:   cfg.Model.Headers,
+		modelName: cfg.Model.ModelName,
+		defaults:  OptionsFromConfig(cfg.Model),
+		retry:     RetryPolicyFromConfig(cfg.Model.Retry),
+		httpClient: &http.Client{
+			// 本地模型首次加载与 CPU 推理都可能较慢，超时比云端接口更宽松
+			Timeout: 5 * time.Minute,
+		},
+		streamClient: &http.Client{},
+	}, nil
+}
+
+// ollamaMessage 是 /api/chat 中的一条消息
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"` // 工具响应对应的工具名称
+}
+
+// ollamaToolCall 是 Ollama 返回的工具调用，arguments 是 JSON 对象而非字符串
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaResponse 是 /api/chat 的响应；流式模式下每行 NDJSON 都是一个该结构
+// 用量只出现在 done 为 true 的最后一个对象中
+type ollamaResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	Error           string        `json:"error,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+// usage 返回响应中的用量
+func (r ollamaResponse) usage() Usage {
+	return Usage{PromptTokens: r.PromptEvalCount, CompletionTokens: r.EvalCount}
+}
+
+// convertMessagesToOllama 将内部消息转换为 Ollama 的消息格式
+func convertMessagesToOllama(messages []protocol.Message) []ollamaMessage {
+	out := make([]ollamaMessage, 0, len(messages))
+	for _, msg := range messages {
+		om := ollamaMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		}
+		if msg.Role == "assistant" && len(msg.ToolCalls) > 0 {
+			if om.Content == "{}" {
+				om.Content = "" // 去掉工具调用时的占位内容
+			}
+			for _, tc := range msg.ToolCalls {
+				var call ollamaToolCall
+				call.Function.Name = tc.Function.Name
+				call.Function.Arguments = json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(call.Function.Arguments) {
+					call.Function.Arguments = json.RawMessage("{}")
+				}
+				om.ToolCalls = append(om.ToolCalls, call)
+			}
+		}
+		if msg.Role == "tool" {
+			om.ToolName = msg.Name
+		}
+		out = append(out, om)
+	}
+	return out
+}
+
+// convertOllamaToolCalls 将 Ollama 的工具调用转换为内部格式
+// Ollama 不返回调用 ID，这里按出现顺序生成，offset 用于保证同一回复内唯一
+func convertOllamaToolCalls(calls []ollamaToolCall, offset int) []protocol.ToolCall {
+	out := make([]protocol.ToolCall, 0, len(calls))
+	for i, c := range calls {
+		args := string(c.Function.Arguments)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		out = append(out, protocol.ToolCall{
+			ID:       fmt.Sprintf("call_%d", offset+i),
+			Type:     "function",
+			Function: protocol.Function{Name: c.Function.Name, Arguments: args},
+		})
+	}
+	return out
+}
+
+// newRequest 构造发往 /api/chat 的 HTTP 请求
+func (o *OllamaModel) newRequest(ctx context.Context, messages []protocol.Message, tools []ToolForAPI, opts *ChatOptions, stream bool) (*http.Request, error) {
+	reqBody := map[string]interface{}{
+		"model":    o.modelName,
+		"messages": convertMessagesToOllama(messages),
+		"stream":   stream,
+	}
+	if len(tools) > 0 {
+		reqBody["tools"] = tools
+	}
+
+	// Ollama 的采样参数放在 options 字段中，名称与 OpenAI 略有不同
+	merged := o.defaults.Merge(opts)
+	options := map[string]interface{}{}
+	if merged.Temperature != nil {
+		options["temperature"] = *merged.Temperature
+	}
+	if merged.MaxTokens != nil {
+		options["num_predict"] = *merged.MaxTokens
+	}
+	if merged.TopP != nil {
+		options["top_p"] = *merged.TopP
+	}
+	if len(merged.Stop) > 0 {
+		options["stop"] = merged.Stop
+	}
+	if merged.PresencePenalty != nil {
+		options["presence_penalty"] = *merged.PresencePenalty
+	}
+	if merged.FrequencyPenalty != nil {
+		options["frequency_penalty"] = *merged.FrequencyPenalty
+	}
+	if merged.Seed != nil {
+		options["seed"] = *merged.Seed
+	}
+	if len(options) > 0 {
+		reqBody["options"] = options
+	}
+	if merged.ResponseFormat == "json_object" {
+		reqBody["format"] = "json"
+	}
+
+	bodyBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+"/api/chat", bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range o.headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// Chat 发送普通对话消息（不使用工具），返回模型的文本回复
+func (o *OllamaModel) Chat(ctx context.Context, messages []protocol.Message) (string, error) {
+	content, _, _, err := o.ChatWithTools(ctx, messages, nil, nil)
+	return content, err
+}
+
+// ChatWithTools 发送支持工具调用的对话请求，返回文本内容和工具调用列表
+func (o *OllamaModel) ChatWithTools(ctx context.Context, messages []protocol.Message, tools []ToolForAPI, opts *ChatOptions) (string, []protocol.ToolCall, Usage, error) {
+	resp, err := doWithRetry(ctx, o.httpClient, o.retry, "Ollama", func(ctx context.Context) (*http.Request, error) {
+		return o.newRequest(ctx, messages, tools, opts, false)
+	})
+	if err != nil {
+		return "", nil, Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, Usage{}, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var apiResp ollamaResponse
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return "", nil, Usage{}, fmt.Errorf("failed to parse Ollama response: %w", err)
+	}
+	if apiResp.Error != "" {
+		return "", nil, Usage{}, fmt.Errorf("Ollama error: %s", apiResp.Error)
+	}
+
+	toolCalls := convertOllamaToolCalls(apiResp.Message.ToolCalls, 0)
+	content := apiResp.Message.Content
+	if content == "" && len(toolCalls) > 0 {
+		content = "{}" // 占位符；实际关注的是 ToolCalls
+	}
+
+	return content, toolCalls, apiResp.usage(), nil
+}
+
+// ChatStream 以流式方式发送支持工具调用的对话请求
+// Ollama 的流式响应是 NDJSON，每行一个 JSON 对象，工具调用以完整对象的形式出现
+func (o *OllamaModel) ChatStream(ctx context.Context, messages []protocol.Message, tools []ToolForAPI, opts *ChatOptions, onDelta StreamHandler) (string, []protocol.ToolCall, Usage, error) {
+	// 重试只发生在收到响应之前，开始接收数据后出错不再重试
+	resp, err := doWithRetry(ctx, o.streamClient, o.retry, "Ollama", func(ctx context.Context) (*http.Request, error) {
+		return o.newRequest(ctx, messages, tools, opts, true)
+	})
+	if err != nil {
+		return "", nil, Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var toolCalls []protocol.ToolCall
+	var usage Usage
+	done := false
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk ollamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return "", nil, Usage{}, fmt.Errorf("failed to parse stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return "", nil, Usage{}, fmt.Errorf("Ollama error: %s", chunk.Error)
+		}
+
+		if chunk.Message.Content != "" {
+			text.WriteString(chunk.Message.Content)
+			if onDelta != nil {
+				onDelta(chunk.Message.Content)
+			}
+		}
+		toolCalls = append(toolCalls, convertOllamaToolCalls(chunk.Message.ToolCalls, len(toolCalls))...)
+
+		if chunk.Done {
+			usage = chunk.usage()
+			done = true
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, Usage{}, fmt.Errorf("failed to read stream: %w", err)
+	}
+	if !done {
+		// 连接在最后一个对象之前断开，已收到的内容不完整
+		return "", nil, Usage{}, fmt.Errorf("stream ended before the final chunk (done: true)")
+	}
+
+	content := text.String()
+	if content == "" && len(toolCalls) > 0 {
+		content = "{}" // 与非流式接口保持一致的占位符
+	}
+
+	return content, toolCalls, usage, nil
+}
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/windlant/mcp-client/internal/config"
+	"github.com/windlant/mcp-client/internal/protocol"
+)
+
+// newTestOllama 创建连接到 srv 的 Ollama 模型，srv 以 lines 作为 NDJSON 流式响应
+func newTestOllama(t *testing.T, lines ...string) Model {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model  string            `json:"model"`
+			Stream bool              `json:"stream"`
+			Tools  []json.RawMessage `json:"tools"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected request to %s: %v", r.URL.Path, err)
+		}
+		if req.Model != "llama3" || !req.Stream || len(req.Tools) != 1 {
+			t.Errorf("request = %+v, want a streaming llama3 request with one tool", req)
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, line := range lines {
+			_, _ = io.WriteString(w, line+"\n")
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	m, err := NewOllamaModel(&config.Config{Model: config.ModelConfig{
+		Provider:  "ollama",
+		ModelName: "llama3",
+		BaseURL:   srv.URL,
+		Retry:     config.RetryConfig{MaxAttempts: 1},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+var timeTool = []ToolForAPI{{Type: "function", Function: ToolFuncDef{Name: "get_time"}}}
+
+func TestOllamaChatStream(t *testing.T) {
+	m := newTestOllama(t,
+		`{"message":{"role":"assistant","content":"It is "},"done":false}`,
+		``,
+		`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"get_time","arguments":{"tz":"UTC"}}}]},"done":false}`,
+		`{"message":{"role":"assistant","content":"noon."},"done":false}`,
+		`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"get_time","arguments":{"tz":"CET"}}},{"function":{"name":"get_time"}}]},"done":false}`,
+		`{"message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":12,"eval_count":7}`,
+	)
+
+	var deltas []string
+	content, calls, usage, err := m.ChatStream(context.Background(), []protocol.Message{{Role: "user", Content: "time?"}}, timeTool, nil,
+		func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if content != "It is noon." || strings.Join(deltas, "|") != "It is |noon." {
+		t.Errorf("content = %q, deltas = %q", content, deltas)
+	}
+	want := []struct{ id, args string }{
+		{"call_0", `{"tz":"UTC"}`},
+		{"call_1", `{"tz":"CET"}`},
+		{"call_2", `{}`},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("got %d tool calls, want %d: %+v", len(calls), len(want), calls)
+	}
+	for i, w := range want {
+		if calls[i].ID != w.id || calls[i].Function.Name != "get_time" || calls[i].Function.Arguments != w.args {
+			t.Errorf("tool call %d = %+v, want %s with %s", i, calls[i], w.id, w.args)
+		}
+	}
+	if usage.PromptTokens != 12 || usage.CompletionTokens != 7 {
+		t.Errorf("usage = %+v, want 12 prompt and 7 completion tokens", usage)
+	}
+}
+
+func TestOllamaChatStreamFailures(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{
+			"ends without done",
+			[]string{`{"message":{"role":"assistant","content":"It is "},"done":false}`},
+			"before the final chunk",
+		},
+		{
+			"empty body",
+			nil,
+			"before the final chunk",
+		},
+		{
+			"error object",
+			[]string{`{"message":{"role":"assistant","content":"It"},"done":false}`, `{"error":"model runner crashed"}`},
+			"model runner crashed",
+		},
+		{
+			"invalid chunk",
+			[]string{`{"message":`},
+			"failed to parse stream chunk",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestOllama(t, tt.lines...)
+			_, _, _, err := m.ChatStream(context.Background(), []protocol.Message{{Role: "user", Content: "time?"}}, timeTool, nil, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/config"
+	"github.com/windlant/mcp-client/internal/protocol"
+)
+
+// DefaultOpenAIBaseURL 是 provider 为 "openai" 且未配置 base_url 时使用的地址
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAICompatModel 是对接任意 OpenAI 兼容 Chat Completions 接口的通用模型实现
+// 适用于 OpenAI、vLLM、llama.cpp server、LM Studio 以及内部网关等
+type OpenAICompatModel struct {
+	name         string // 用于错误信息的提供方名称
+	baseURL      string // 不含 /chat/completions 的基础地址
+	apiKey       string
+	organization string
+	headers      map[string]string // 附加的自定义请求头
+	modelName    string
+	defaults     ChatOptions // 来自配置的默认采样参数
+	retry        RetryPolicy // 临时性错误的重试策略
+	httpClient   *http.Client
+	streamClient *http.Client // 流式请求专用，不设置整体超时
+}
+
+// NewOpenAICompatModel 根据配置创建通用的 OpenAI 兼容模型实例
+func NewOpenAICompatModel(cfg *config.Config) (Model, error) {
+	baseURL := cfg.Model.BaseURL
+	if baseURL == "" && cfg.Model.Provider == "openai" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	if baseURL == "" {
+		return nil, fmt.Errorf("base_url is required for provider %q", cfg.Model.Provider)
+	}
+	return newOpenAICompatModel("OpenAI-compatible", baseURL, cfg), nil
+}
+
+// newOpenAICompatModel 创建 OpenAICompatModel，供各个兼容提供方复用
+func newOpenAICompatModel(name, baseURL string, cfg *config.Config) *OpenAICompatModel {
+	return &OpenAICompatModel{
+		name:         name,
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		apiKey:       cfg.Model.APIKey,
+		organization: cfg.Model.Organization,
+		headers:      cfg.Model.Headers,
+		modelName:    cfg.Model.ModelName,
+		defaults:     OptionsFromConfig(cfg.Model),
+		retry:        RetryPolicyFromConfig(cfg.Model.Retry),
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+		streamClient: &http.Client{},
+	}
+}
+
+// newRequest 构造发往 /chat/completions 的 HTTP 请求
+func (o *OpenAICompatModel) newRequest(ctx context.Context, reqBody map[string]interface{}) (*http.Request, error) {
+	bodyBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+"/chat/completions", bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+	if o.organization != "" {
+		req.Header.Set("OpenAI-Organization", o.organization)
+	}
+	for k, v := range o.headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// buildBody 构造请求体，tools 为空时不携带工具相关字段
+func (o *OpenAICompatModel) buildBody(messages []protocol.Message, tools []ToolForAPI, opts *ChatOptions, stream bool) map[string]interface{} {
+	reqBody := map[string]interface{}{
+		"model":    o.modelName,
+		"messages": messages,
+		"stream":   stream,
+	}
+	if len(tools) > 0 {
+		reqBody["tools"] = tools
+		reqBody["tool_choice"] = "auto"
+	}
+	if stream {
+		// 要求在流的最后一个数据块中返回用量
+		reqBody["stream_options"] = map[string]bool{"include_usage": true}
+	}
+
+	// 只发送已设置的采样参数，未设置的由服务端使用默认值
+	merged := o.defaults.Merge(opts)
+	if merged.Temperature != nil {
+		reqBody["temperature"] = *merged.Temperature
+	}
+	if merged.MaxTokens != nil {
+		reqBody["max_tokens"] = *merged.MaxTokens
+	}
+	if merged.TopP != nil {
+		reqBody["top_p"] = *merged.TopP
+	}
+	if len(merged.Stop) > 0 {
+		reqBody["stop"] = merged.Stop
+	}
+	if merged.PresencePenalty != nil {
+		reqBody["presence_penalty"] = *merged.PresencePenalty
+	}
+	if merged.FrequencyPenalty != nil {
+		reqBody["frequency_penalty"] = *merged.FrequencyPenalty
+	}
+	if merged.Seed != nil {
+		reqBody["seed"] = *merged.Seed
+	}
+	if merged.ResponseFormat != "" {
+		reqBody["response_format"] = map[string]string{"type": merged.ResponseFormat}
+	}
+	return reqBody
+}
+
+// Chat 发送普通对话消息（不使用工具），返回模型的文本回复
+func (o *OpenAICompatModel) Chat(ctx context.Context, messages []protocol.Message) (string, error) {
+	content, _, _, err := o.ChatWithTools(ctx, messages, nil, nil)
+	return content, err
+}
+
+// ChatWithTools 发送支持工具调用的对话请求，返回文本内容和工具调用列表
+func (o *OpenAICompatModel) ChatWithTools(ctx context.Context, messages []protocol.Message, tools []ToolForAPI, opts *ChatOptions) (string, []protocol.ToolCall, Usage, error) {
+	body := o.buildBody(messages, tools, opts, false)
+	resp, err := doWithRetry(ctx, o.httpClient, o.retry, o.name, func(ctx context.Context) (*http.Request, error) {
+		return o.newRequest(ctx, body)
+	})
+	if err != nil {
+		return "", nil, Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, Usage{}, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var apiResp struct {
+		Choices []struct {
+			Message struct {
+				Content   string              `json:"content"`
+				ToolCalls []protocol.ToolCall `json:"tool_calls,omitempty"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage *openAIUsage `json:"usage,omitempty"`
+	}
+
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return "", nil, Usage{}, fmt.Errorf("failed to parse %s response: %w", o.name, err)
+	}
+
+	if len(apiResp.Choices) == 0 {
+		return "", nil, Usage{}, fmt.Errorf("no choices returned from %s", o.name)
+	}
+
+	msg := apiResp.Choices[0].Message
+	content := msg.Content
+	if content == "" && len(msg.ToolCalls) > 0 {
+		content = "{}" // 占位符；实际关注的是 ToolCalls
+	}
+
+	return content, msg.ToolCalls, apiResp.Usage.toUsage(), nil
+}
+
+// ChatStream 以流式方式发送支持工具调用的对话请求
+// 文本增量通过 onDelta 实时回调，工具调用增量在内部拼接完整后随返回值一并给出
+func (o *OpenAICompatModel) ChatStream(ctx context.Context, messages []protocol.Message, tools []ToolForAPI, opts *ChatOptions, onDelta StreamHandler) (string, []protocol.ToolCall, Usage, error) {
+	body := o.buildBody(messages, tools, opts, true)
+
+	// 流式响应可能持续较长时间，不使用整体超时，由服务端的结束标记终止
+	// 重试只发生在收到响应之前，开始接收数据后出错不再重试
+	resp, err := doWithRetry(ctx, o.streamClient, o.retry, o.name, func(ctx context.Context) (*http.Request, error) {
+		req, err := o.newRequest(ctx, body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		return req, nil
+	})
+	if err != nil {
+		return "", nil, Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	content, toolCalls, usage, err := parseChatStream(resp.Body, onDelta)
+	if err != nil {
+		return "", nil, Usage{}, err
+	}
+
+	if content == "" && len(toolCalls) > 0 {
+		content = "{}" // 与非流式接口保持一致的占位符
+	}
+
+	return content, toolCalls, usage, nil
+}
@@ -0,0 +1,67 @@
+package model
+
+import "github.com/windlant/mcp-client/internal/config"
+
+// ChatOptions 描述单次请求的采样参数
+// 指针字段为 nil、切片为空或字符串为空时表示未设置，由模型使用默认值
+type ChatOptions struct {
+	Temperature      *float64
+	MaxTokens        *int
+	TopP             *float64
+	Stop             []string
+	PresencePenalty  *float64
+	FrequencyPenalty *float64
+	Seed             *int
+	ResponseFormat   string // "text" 或 "json_object"
+}
+
+// OptionsFromConfig 根据配置构造默认的采样参数
+func OptionsFromConfig(mc config.ModelConfig) ChatOptions {
+	// 配置中显式设置的 0（例如 temperature: 0 表示确定性采样）同样会发送给模型
+	opts := ChatOptions{
+		Temperature:      mc.Temperature,
+		TopP:             mc.TopP,
+		Stop:             mc.Stop,
+		PresencePenalty:  mc.PresencePenalty,
+		FrequencyPenalty: mc.FrequencyPenalty,
+		Seed:             mc.Seed,
+		ResponseFormat:   mc.ResponseFormat,
+	}
+	if mc.MaxTokens > 0 {
+		maxTokens := mc.MaxTokens
+		opts.MaxTokens = &maxTokens
+	}
+	return opts
+}
+
+// Merge 返回以 override 中已设置的字段覆盖 o 后的采样参数，override 可以为 nil
+func (o ChatOptions) Merge(override *ChatOptions) ChatOptions {
+	if override == nil {
+		return o
+	}
+	if override.Temperature != nil {
+		o.Temperature = override.Temperature
+	}
+	if override.MaxTokens != nil {
+		o.MaxTokens = override.MaxTokens
+	}
+	if override.TopP != nil {
+		o.TopP = override.TopP
+	}
+	if len(override.Stop) > 0 {
+		o.Stop = override.Stop
+	}
+	if override.PresencePenalty != nil {
+		o.PresencePenalty = override.PresencePenalty
+	}
+	if override.FrequencyPenalty != nil {
+		o.FrequencyPenalty = override.FrequencyPenalty
+	}
+	if override.Seed != nil {
+		o.Seed = override.Seed
+	}
+	if override.ResponseFormat != "" {
+		o.ResponseFormat = override.ResponseFormat
+	}
+	return o
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/windlant/mcp-client/internal/config"
+)
+
+func TestOptionsFromConfigKeepsExplicitZeros(t *testing.T) {
+	var mc config.ModelConfig
+	data := "temperature: 0\ntop_p: 0\npresence_penalty: 0\nfrequency_penalty: 0\n"
+	if err := yaml.Unmarshal([]byte(data), &mc); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := OptionsFromConfig(mc)
+	for name, v := range map[string]*float64{
+		"temperature":       opts.Temperature,
+		"top_p":             opts.TopP,
+		"presence_penalty":  opts.PresencePenalty,
+		"frequency_penalty": opts.FrequencyPenalty,
+	} {
+		if v == nil || *v != 0 {
+			t.Errorf("%s = %v, want an explicit 0", name, v)
+		}
+	}
+}
+
+func TestOptionsFromConfigOmitsUnsetFields(t *testing.T) {
+	var mc config.ModelConfig
+	if err := yaml.Unmarshal([]byte("max_tokens: 512\n"), &mc); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := OptionsFromConfig(mc)
+	if opts.Temperature != nil || opts.TopP != nil || opts.PresencePenalty != nil || opts.FrequencyPenalty != nil {
+		t.Fatalf("unset sampling parameters must stay nil: %+v", opts)
+	}
+	if opts.MaxTokens == nil || *opts.MaxTokens != 512 {
+		t.Fatalf("max_tokens = %v", opts.MaxTokens)
+	}
+}
@@ -0,0 +1,262 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+)
+
+// PromptToolModel 为不支持原生工具调用的模型提供基于提示词的工具调用协议
+// 它把工具定义写入 system 提示，要求模型以 JSON 输出工具调用，再从纯文本回复中解析出来
+type PromptToolModel struct {
+	inner Model
+}
+
+// NewPromptToolModel 用基于提示词的工具调用协议包装一个模型
+func NewPromptToolModel(inner Model) Model {
+	return &PromptToolModel{inner: inner}
+}
+
+// promptToolInstruction 是追加到 system 提示中的工具调用协议说明
+const promptToolInstruction = `You have access to the following tools:
+%s
+
+To call one or more tools, reply with ONLY a JSON object in exactly this format and nothing else:
+{"tool_calls": [{"name": "<tool name>", "arguments": {<arguments as a JSON object>}}]}
+
+The tool results will be sent back to you in the next message. If no tool is needed, answer the user directly without any JSON.`
+
+// emptyFencePattern 匹配移除工具调用 JSON 后残留的空代码块
+var emptyFencePattern = regexp.MustCompile("```[a-zA-Z]*\\s*```")
+
+// buildToolPrompt 生成描述可用工具及调用格式的提示词
+func buildToolPrompt(tools []ToolForAPI) string {
+	defs := make([]ToolFuncDef, len(tools))
+	for i, t := range tools {
+		defs[i] = t.Function
+	}
+	defsJSON, _ := json.MarshalIndent(defs, "", "  ")
+	return fmt.Sprintf(promptToolInstruction, string(defsJSON))
+}
+
+// rewriteMessagesForPrompt 将包含工具调用的历史改写为不依赖原生工具字段的纯文本对话
+// tools 为空时只改写历史，不注入工具说明
+func rewriteMessagesForPrompt(messages []protocol.Message, tools []ToolForAPI) []protocol.Message {
+	toolPrompt := ""
+	if len(tools) > 0 {
+		toolPrompt = buildToolPrompt(tools)
+	}
+	out := make([]protocol.Message, 0, len(messages)+1)
+	injected := toolPrompt == ""
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			if !injected {
+				msg.Content = strings.TrimSpace(msg.Content + "\n\n" + toolPrompt)
+				injected = true
+			}
+			out = append(out, msg)
+
+		case "assistant":
+			if len(msg.ToolCalls) > 0 {
+				out = append(out, protocol.Message{
+					Role:    "assistant",
+					Content: formatPromptToolCalls(msg.ToolCalls),
+				})
+				continue
+			}
+			out = append(out, protocol.Message{Role: "assistant", Content: msg.Content})
+
+		case "tool":
+			out = append(out, protocol.Message{
+				Role:    "user",
+				Content: fmt.Sprintf("Tool result for %s (call %s):\n%s", msg.Name, msg.ToolCallID, msg.Content),
+			})
+
+		default:
+			out = append(out, msg)
+		}
+	}
+
+	if !injected {
+		out = append([]protocol.Message{{Role: "system", Content: toolPrompt}}, out...)
+	}
+	return out
+}
+
+// promptToolCall 是提示词协议中单个工具调用的 JSON 结构
+type promptToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// formatPromptToolCalls 将工具调用序列化为提示词协议要求的 JSON 文本
+func formatPromptToolCalls(toolCalls []protocol.ToolCall) string {
+	calls := make([]promptToolCall, len(toolCalls))
+	for i, tc := range toolCalls {
+		args := json.RawMessage(tc.Function.Arguments)
+		if !json.Valid(args) {
+			args = json.RawMessage("{}")
+		}
+		calls[i] = promptToolCall{Name: tc.Function.Name, Arguments: args}
+	}
+	data, _ := json.Marshal(map[string]interface{}{"tool_calls": calls})
+	return string(data)
+}
+
+// parsePromptToolCalls 从模型的纯文本回复中解析工具调用
+// 支持 {"tool_calls": [...]}、{"name": ..., "arguments": ...} 与 {"tool": ..., "arguments": ...} 三种写法，
+// 只有名称属于已知工具的调用才会被识别；返回去掉工具调用 JSON 后的剩余文本
+func parsePromptToolCalls(text string, tools []ToolForAPI) (string, []protocol.ToolCall) {
+	known := make(map[string]bool, len(tools))
+	for _, t := range tools {
+		known[t.Function.Name] = true
+	}
+
+	var toolCalls []protocol.ToolCall
+	var rest strings.Builder
+	i := 0
+	for i < len(text) {
+		j := strings.IndexByte(text[i:], '{')
+		if j < 0 {
+			rest.WriteString(text[i:])
+			break
+		}
+		j += i
+
+		dec := json.NewDecoder(strings.NewReader(text[j:]))
+		var raw map[string]json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			rest.WriteString(text[i : j+1])
+			i = j + 1
+			continue
+		}
+		end := j + int(dec.InputOffset())
+
+		found := extractPromptToolCalls(raw, known)
+		if len(found) == 0 {
+			rest.WriteString(text[i:end])
+			i = end
+			continue
+		}
+
+		rest.WriteString(text[i:j])
+		for _, call := range found {
+			toolCalls = append(toolCalls, protocol.ToolCall{
+				ID:       fmt.Sprintf("call_%d", len(toolCalls)),
+				Type:     "function",
+				Function: protocol.Function{Name: call.Name, Arguments: string(call.Arguments)},
+			})
+		}
+		i = end
+	}
+
+	content := strings.TrimSpace(emptyFencePattern.ReplaceAllString(rest.String(), ""))
+	return content, toolCalls
+}
+
+// extractPromptToolCalls 从一个已解析的 JSON 对象中提取工具调用
+func extractPromptToolCalls(raw map[string]json.RawMessage, known map[string]bool) []promptToolCall {
+	var candidates []map[string]json.RawMessage
+	if list, ok := raw["tool_calls"]; ok {
+		if err := json.Unmarshal(list, &candidates); err != nil {
+			return nil
+		}
+	} else {
+		candidates = []map[string]json.RawMessage{raw}
+	}
+
+	var calls []promptToolCall
+	for _, c := range candidates {
+		var name string
+		if v, ok := c["name"]; ok {
+			_ = json.Unmarshal(v, &name)
+		} else if v, ok := c["tool"]; ok {
+			_ = json.Unmarshal(v, &name)
+		}
+		if !known[name] {
+			continue
+		}
+
+		args := c["arguments"]
+		if len(args) == 0 || string(args) == "null" {
+			args = json.RawMessage("{}")
+		}
+		// 部分模型会把 arguments 写成 JSON 字符串
+		var argsStr string
+		if json.Unmarshal(args, &argsStr) == nil && json.Valid([]byte(argsStr)) {
+			args = json.RawMessage(argsStr)
+		}
+		calls = append(calls, promptToolCall{Name: name, Arguments: args})
+	}
+	return calls
+}
+
+// Chat 将历史改写为纯文本对话后转发给被包装的模型
+func (p *PromptToolModel) Chat(ctx context.Context, messages []protocol.Message) (string, error) {
+	return p.inner.Chat(ctx, rewriteMessagesForPrompt(messages, nil))
+}
+
+// ChatWithTools 通过提示词描述工具，并从回复文本中解析工具调用
+func (p *PromptToolModel) ChatWithTools(ctx context.Context, messages []protocol.Message, tools []ToolForAPI, opts *ChatOptions) (string, []protocol.ToolCall, Usage, error) {
+	if len(tools) == 0 {
+		return p.inner.ChatWithTools(ctx, rewriteMessagesForPrompt(messages, nil), nil, opts)
+	}
+
+	text, _, usage, err := p.inner.ChatWithTools(ctx, rewriteMessagesForPrompt(messages, tools), nil, opts)
+	if err != nil {
+		return "", nil, Usage{}, err
+	}
+
+	content, toolCalls := parsePromptToolCalls(text, tools)
+	if content == "" && len(toolCalls) > 0 {
+		content = "{}" // 占位符；实际关注的是 ToolCalls
+	}
+	return content, toolCalls, usage, nil
+}
+
+// ChatStream 是 ChatWithTools 的流式版本
+// 回复以 JSON 或代码块开头时可能是工具调用，此时先缓存不输出，结束后若未解析出工具调用再一次性输出
+func (p *PromptToolModel) ChatStream(ctx context.Context, messages []protocol.Message, tools []ToolForAPI, opts *ChatOptions, onDelta StreamHandler) (string, []protocol.ToolCall, Usage, error) {
+	if len(tools) == 0 {
+		return p.inner.ChatStream(ctx, rewriteMessagesForPrompt(messages, nil), nil, opts, onDelta)
+	}
+
+	var pending strings.Builder
+	decided, holding := false, false
+	text, _, usage, err := p.inner.ChatStream(ctx, rewriteMessagesForPrompt(messages, tools), nil, opts, func(delta string) {
+		if decided {
+			if !holding && onDelta != nil {
+				onDelta(delta)
+			}
+			return
+		}
+		pending.WriteString(delta)
+		trimmed := strings.TrimSpace(pending.String())
+		if trimmed == "" {
+			return
+		}
+		decided = true
+		holding = strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "`")
+		if !holding && onDelta != nil {
+			onDelta(pending.String())
+		}
+	})
+	if err != nil {
+		return "", nil, Usage{}, err
+	}
+
+	content, toolCalls := parsePromptToolCalls(text, tools)
+	if holding && onDelta != nil && content != "" {
+		onDelta(content)
+	}
+	if content == "" && len(toolCalls) > 0 {
+		content = "{}" // 与非流式接口保持一致的占位符
+	}
+	return content, toolCalls, usage, nil
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParsePromptToolCalls(t *testing.T) {
+	tools := []ToolForAPI{
+		{Type: "function", Function: ToolFuncDef{Name: "get_time"}},
+		{Type: "function", Function: ToolFuncDef{Name: "read_file"}},
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		content string
+		calls   []string // "名称 参数"
+	}{
+		{
+			name:    "plain answer",
+			text:    "It is noon.",
+			content: "It is noon.",
+		},
+		{
+			name:    "tool_calls object",
+			text:    `{"tool_calls": [{"name": "get_time", "arguments": {"tz": "UTC"}}]}`,
+			content: "",
+			calls:   []string{`get_time {"tz": "UTC"}`},
+		},
+		{
+			name:    "fenced json",
+			text:    "```json\n{\"tool_calls\": [{\"name\": \"get_time\", \"arguments\": {}}]}\n```",
+			content: "",
+			calls:   []string{`get_time {}`},
+		},
+		{
+			name:    "surrounding prose",
+			text:    "Let me check.\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"a.txt\"}}\nOne moment.",
+			content: "Let me check.\n\nOne moment.",
+			calls:   []string{`read_file {"path": "a.txt"}`},
+		},
+		{
+			name:    "several calls",
+			text:    `{"tool_calls": [{"name": "get_time", "arguments": {"tz": "UTC"}}, {"tool": "read_file", "arguments": "{\"path\":\"b\"}"}]} {"name": "get_time"}`,
+			content: "",
+			calls:   []string{`get_time {"tz": "UTC"}`, `read_file {"path":"b"}`, `get_time {}`},
+		},
+		{
+			name:    "malformed json",
+			text:    `{"name": "get_time", "arguments": {"tz": }`,
+			content: `{"name": "get_time", "arguments": {"tz": }`,
+		},
+		{
+			name:    "malformed json before a call",
+			text:    `{oops} {"name": "get_time", "arguments": null}`,
+			content: `{oops}`,
+			calls:   []string{`get_time {}`},
+		},
+		{
+			name:    "unknown tool",
+			text:    `{"name": "delete_everything", "arguments": {}}`,
+			content: `{"name": "delete_everything", "arguments": {}}`,
+		},
+		{
+			name:    "unrelated json",
+			text:    `The answer is {"value": 42}.`,
+			content: `The answer is {"value": 42}.`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, calls := parsePromptToolCalls(tt.text, tools)
+			if content != tt.content {
+				t.Errorf("content = %q, want %q", content, tt.content)
+			}
+			if len(calls) != len(tt.calls) {
+				t.Fatalf("got %d tool calls %+v, want %d", len(calls), calls, len(tt.calls))
+			}
+			for i, call := range calls {
+				if got := call.Function.Name + " " + call.Function.Arguments; got != tt.calls[i] {
+					t.Errorf("call %d = %s, want %s", i, got, tt.calls[i])
+				}
+				if want := fmt.Sprintf("call_%d", i); call.ID != want || call.Type != "function" {
+					t.Errorf("call %d has id %q type %q, want %s function", i, call.ID, call.Type, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/config"
+)
+
+// RetryPolicy 描述模型请求失败时的重试策略（指数退避 + 随机抖动）
+type RetryPolicy struct {
+	MaxAttempts    int           // 最大尝试次数（含首次请求），1 表示不重试
+	InitialBackoff time.Duration // 首次重试前的基础等待时间
+	MaxBackoff     time.Duration // 单次等待时间的上限
+	MaxElapsed     time.Duration // 从首次请求开始计算的总期限，0 表示不限制
+}
+
+// RetryPolicyFromConfig 根据配置构造重试策略
+func RetryPolicyFromConfig(rc config.RetryConfig) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    rc.MaxAttempts,
+		InitialBackoff: rc.InitialBackoff,
+		MaxBackoff:     rc.MaxBackoff,
+		MaxElapsed:     rc.MaxElapsed,
+	}
+}
+
+// backoff 返回第 attempt 次重试（从 0 开始）前的等待时间
+// 采用 "equal jitter"：在 [d/2, d) 区间内随机取值，避免多个客户端同时重试
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 0; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// parseRetryAfter 解析 Retry-After（秒数或 HTTP 日期）以及 OpenAI 的 retry-after-ms 响应头
+func parseRetryAfter(header http.Header) time.Duration {
+	if header == nil {
+		return 0
+	}
+	if ms := header.Get("retry-after-ms"); ms != "" {
+		if v, err := strconv.ParseFloat(ms, 64); err == nil && v > 0 {
+			return time.Duration(v * float64(time.Millisecond))
+		}
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// ErrRetryDeadline 表示请求在 MaxElapsed 总期限内没有完成
+var ErrRetryDeadline = fmt.Errorf("retry deadline exceeded: %w", context.DeadlineExceeded)
+
+// doWithRetry 发送请求并在遇到临时性错误时按策略重试
+// newReq 每次尝试都会被调用，以便重新构造请求体，请求必须使用传入的 ctx：设置了 MaxElapsed 时，
+// 每次尝试只能使用总期限的剩余时间，等待响应超出总期限时中止请求并返回 ErrRetryDeadline。
+// 期限只约束收到响应之前的阶段，返回的响应体（例如持续较久的流式输出）不受其限制。
+// 只有状态码为 200 时才返回响应，其余情况读取并关闭响应体后返回分类后的 *APIError
+func doWithRetry(ctx context.Context, client *http.Client, policy RetryPolicy, provider string, newReq func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	start := time.Now()
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		resp, err := doAttempt(ctx, client, policy, start, newReq)
+		if err == nil && resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+
+		// 调用方主动取消或超时，不再重试
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctxErr
+		}
+
+		var wait time.Duration
+		switch {
+		case errors.Is(err, ErrRetryDeadline):
+			if lastErr != nil {
+				return nil, fmt.Errorf("request did not complete within %s: %w (last error: %v)", policy.MaxElapsed, err, lastErr)
+			}
+			return nil, fmt.Errorf("request did not complete within %s: %w", policy.MaxElapsed, err)
+		case err != nil:
+			lastErr = fmt.Errorf("failed to send request (%w): %w", ErrNetwork, err)
+		default:
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			apiErr := newAPIError(provider, resp.StatusCode, respBody, resp.Header)
+			lastErr = apiErr
+			wait = apiErr.RetryAfter
+		}
+
+		if !isRetryable(lastErr) || attempt == maxAttempts-1 {
+			break
+		}
+
+		// 服务端给出 Retry-After 时以其为准，否则使用指数退避
+		if wait <= 0 {
+			wait = policy.backoff(attempt)
+		}
+		if policy.MaxElapsed > 0 && time.Since(start)+wait > policy.MaxElapsed {
+			break
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, lastErr
+}
+
+// doAttempt 发送一次请求，设置了 MaxElapsed 时在总期限到达后中止请求
+// 成功收到响应后停止计时，响应体关闭时释放该次请求的 context
+func doAttempt(ctx context.Context, client *http.Client, policy RetryPolicy, start time.Time, newReq func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	attemptCtx, cancel := context.WithCancel(ctx)
+	var deadline *time.Timer
+	if policy.MaxElapsed > 0 {
+		remaining := policy.MaxElapsed - time.Since(start)
+		if remaining <= 0 {
+			cancel()
+			return nil, ErrRetryDeadline
+		}
+		deadline = time.AfterFunc(remaining, cancel)
+	}
+
+	req, err := newReq(attemptCtx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if deadline != nil && !deadline.Stop() && ctx.Err() == nil {
+		// 计时器已经触发：请求因总期限被中止，或响应恰好在期限到达时才收到
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, ErrRetryDeadline
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose 在响应体关闭时释放请求的 context
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
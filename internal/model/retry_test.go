@@ -0,0 +1,256 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingServer 按 handlers 的顺序处理请求，超出部分使用最后一个，并统计请求次数
+func failingServer(t *testing.T, handlers ...http.HandlerFunc) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		if n > len(handlers) {
+			n = len(handlers)
+		}
+		handlers[n-1](w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func status(code int, header ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i+1 < len(header); i += 2 {
+			w.Header().Set(header[i], header[i+1])
+		}
+		w.WriteHeader(code)
+		_, _ = io.WriteString(w, `{"error":{"message":"`+http.StatusText(code)+`"}}`)
+	}
+}
+
+func ok(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.WriteString(w, `{"ok":true}`)
+}
+
+// getWithRetry 以 policy 向 url 发送 GET 请求
+func getWithRetry(ctx context.Context, client *http.Client, policy RetryPolicy, url string) (*http.Response, error) {
+	return doWithRetry(ctx, client, policy, "Test", func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	})
+}
+
+var fastPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     50 * time.Millisecond,
+	MaxElapsed:     10 * time.Second,
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	srv, calls := failingServer(t, status(http.StatusTooManyRequests, "Retry-After", "1"), ok)
+
+	start := time.Now()
+	resp, err := getWithRetry(context.Background(), srv.Client(), fastPolicy, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if *calls != 2 {
+		t.Fatalf("got %d requests, want 2", *calls)
+	}
+	// Retry-After 优先于 10ms 的指数退避
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("retried after %s, want about 1s", elapsed)
+	}
+}
+
+func TestRetryAfterHTTPDate(t *testing.T) {
+	// HTTP 日期精确到秒，取 2s 之后保证等待时间大于 1s
+	date := time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat)
+	srv, calls := failingServer(t, status(http.StatusTooManyRequests, "Retry-After", date), ok)
+
+	start := time.Now()
+	resp, err := getWithRetry(context.Background(), srv.Client(), fastPolicy, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if *calls != 2 {
+		t.Fatalf("got %d requests, want 2", *calls)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("retried after %s, want to wait until %s", elapsed, date)
+	}
+}
+
+func TestRetryServerErrorsThenSuccess(t *testing.T) {
+	srv, calls := failingServer(t,
+		status(http.StatusInternalServerError),
+		status(http.StatusBadGateway),
+		status(529), // Anthropic 过载
+		ok,
+	)
+
+	resp, err := getWithRetry(context.Background(), srv.Client(), fastPolicy, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if *calls != 4 || string(body) != `{"ok":true}` {
+		t.Fatalf("got %d requests and body %q", *calls, body)
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	srv, calls := failingServer(t, status(http.StatusServiceUnavailable))
+
+	_, err := getWithRetry(context.Background(), srv.Client(), fastPolicy, srv.URL)
+	if !errors.Is(err, ErrServerError) {
+		t.Fatalf("got %v, want ErrServerError", err)
+	}
+	if *calls != int32(fastPolicy.MaxAttempts) {
+		t.Fatalf("got %d requests, want %d", *calls, fastPolicy.MaxAttempts)
+	}
+}
+
+func TestNonRetryableErrors(t *testing.T) {
+	for _, tc := range []struct {
+		code int
+		kind error
+	}{
+		{http.StatusBadRequest, ErrBadRequest},
+		{http.StatusUnauthorized, ErrAuthFailed},
+		{http.StatusForbidden, ErrAuthFailed},
+	} {
+		t.Run(strconv.Itoa(tc.code), func(t *testing.T) {
+			srv, calls := failingServer(t, status(tc.code), ok)
+
+			_, err := getWithRetry(context.Background(), srv.Client(), fastPolicy, srv.URL)
+			if !errors.Is(err, tc.kind) {
+				t.Fatalf("got %v, want %v", err, tc.kind)
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tc.code {
+				t.Fatalf("got %v, want an *APIError with status %d", err, tc.code)
+			}
+			if *calls != 1 {
+				t.Fatalf("got %d requests, want 1", *calls)
+			}
+		})
+	}
+}
+
+func TestTotalDeadlineAbortsHangingAttempt(t *testing.T) {
+	hang := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+	srv, _ := failingServer(t, status(http.StatusServiceUnavailable), hang)
+
+	policy := fastPolicy
+	policy.MaxElapsed = 300 * time.Millisecond
+
+	// 不设置超时的客户端（与流式请求使用的客户端相同），只能依靠总期限结束请求
+	start := time.Now()
+	_, err := getWithRetry(context.Background(), &http.Client{}, policy, srv.URL)
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrRetryDeadline) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want ErrRetryDeadline", err)
+	}
+	if elapsed > time.Second {
+		t.Fatalf("request ran for %s, past the %s deadline", elapsed, policy.MaxElapsed)
+	}
+}
+
+func TestTotalDeadlineStopsRetrying(t *testing.T) {
+	srv, calls := failingServer(t, status(http.StatusServiceUnavailable, "Retry-After", "1"))
+
+	policy := fastPolicy
+	policy.MaxElapsed = 500 * time.Millisecond
+
+	start := time.Now()
+	_, err := getWithRetry(context.Background(), srv.Client(), policy, srv.URL)
+	if !errors.Is(err, ErrServerError) {
+		t.Fatalf("got %v, want the last ErrServerError", err)
+	}
+	// 等待 Retry-After 会超出总期限，因此不再重试
+	if *calls != 1 || time.Since(start) > policy.MaxElapsed {
+		t.Fatalf("got %d requests in %s", *calls, time.Since(start))
+	}
+}
+
+func TestTotalDeadlineDoesNotCutResponseBody(t *testing.T) {
+	slowBody := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		time.Sleep(400 * time.Millisecond)
+		_, _ = io.WriteString(w, "data: second\n\n")
+	}
+	srv, _ := failingServer(t, slowBody)
+
+	policy := fastPolicy
+	policy.MaxElapsed = 200 * time.Millisecond
+
+	resp, err := getWithRetry(context.Background(), &http.Client{}, policy, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading the body failed after the deadline: %v", err)
+	}
+	if string(body) != "data: first\n\ndata: second\n\n" {
+		t.Fatalf("got body %q", body)
+	}
+}
+
+func TestCallerCancellationIsNotRetried(t *testing.T) {
+	srv, calls := failingServer(t, status(http.StatusServiceUnavailable, "Retry-After", "5"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err := getWithRetry(ctx, srv.Client(), fastPolicy, srv.URL)
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrRetryDeadline) {
+		t.Fatalf("got %v, want the caller's context error", err)
+	}
+	if *calls != 1 {
+		t.Fatalf("got %d requests, want 1", *calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	future := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	for _, tc := range []struct {
+		header   http.Header
+		min, max time.Duration
+	}{
+		{http.Header{"Retry-After": {"3"}}, 3 * time.Second, 3 * time.Second},
+		{http.Header{"Retry-After": {"1.5"}}, 1500 * time.Millisecond, 1500 * time.Millisecond},
+		{http.Header{"Retry-After": {future}}, 28 * time.Second, 30 * time.Second},
+		{http.Header{"Retry-After": {"Wed, 21 Oct 2015 07:28:00 GMT"}}, 0, 0}, // 已经过去的时间
+		{http.Header{"Retry-After-Ms": {"250"}, "Retry-After": {"9"}}, 250 * time.Millisecond, 250 * time.Millisecond},
+		{http.Header{"Retry-After": {"soon"}}, 0, 0},
+		{nil, 0, 0},
+	} {
+		if got := parseRetryAfter(tc.header); got < tc.min || got > tc.max {
+			t.Errorf("parseRetryAfter(%v) = %s, want between %s and %s", tc.header, got, tc.min, tc.max)
+		}
+	}
+}
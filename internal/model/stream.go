@@ -0,0 +1,154 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/sse"
+)
+
+// StreamHandler 在流式响应中每收到一段文本增量时被调用
+type StreamHandler func(delta string)
+
+// streamChunk 是 OpenAI 兼容接口流式响应中单个 SSE 数据块的结构
+// 请求携带 stream_options.include_usage 时，最后一个数据块的 usage 字段包含整次请求的用量
+type streamChunk struct {
+	Usage   *openAIUsage `json:"usage,omitempty"`
+	Choices []struct {
+		Delta struct {
+			Content   string          `json:"content"`
+			ToolCalls []toolCallDelta `json:"tool_calls,omitempty"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// toolCallDelta 表示工具调用的一个增量片段，同一调用的片段通过 Index 关联
+type toolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments,omitempty"`
+	} `json:"function"`
+}
+
+// readSSE 逐条读取 server-sent events 流，并对每个事件的 data 调用 fn
+// 遇到 "[DONE]" 时返回 nil；流在此之前结束时返回 io.ErrUnexpectedEOF，由调用方根据已收到的结束标志判断回复是否完整；
+// fn 返回错误时立即中止
+func readSSE(r io.Reader, fn func(data []byte) error) error {
+	reader := sse.NewReader(r)
+	for {
+		ev, err := reader.Next()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read stream: %w", err)
+		}
+		if ev.Data == "" {
+			continue
+		}
+		if ev.Data == "[DONE]" {
+			return nil
+		}
+		if err := fn([]byte(ev.Data)); err != nil {
+			return err
+		}
+	}
+}
+
+// toolCallAccumulator 将按片段到达的工具调用增量拼接为完整的工具调用
+type toolCallAccumulator struct {
+	calls map[int]*protocol.ToolCall
+}
+
+func newToolCallAccumulator() *toolCallAccumulator {
+	return &toolCallAccumulator{calls: make(map[int]*protocol.ToolCall)}
+}
+
+// add 合并一个工具调用增量
+func (a *toolCallAccumulator) add(d toolCallDelta) {
+	tc, ok := a.calls[d.Index]
+	if !ok {
+		tc = &protocol.ToolCall{Type: "function"}
+		a.calls[d.Index] = tc
+	}
+	if d.ID != "" {
+		tc.ID = d.ID
+	}
+	if d.Type != "" {
+		tc.Type = d.Type
+	}
+	tc.Function.Name += d.Function.Name
+	tc.Function.Arguments += d.Function.Arguments
+}
+
+// result 按 index 顺序返回拼接完成的工具调用列表
+func (a *toolCallAccumulator) result() []protocol.ToolCall {
+	if len(a.calls) == 0 {
+		return nil
+	}
+	indexes := make([]int, 0, len(a.calls))
+	for idx := range a.calls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	toolCalls := make([]protocol.ToolCall, 0, len(indexes))
+	for _, idx := range indexes {
+		toolCalls = append(toolCalls, *a.calls[idx])
+	}
+	return toolCalls
+}
+
+// parseChatStream 解析 OpenAI 兼容格式的流式响应，返回完整文本、工具调用与用量
+func parseChatStream(r io.Reader, onDelta StreamHandler) (string, []protocol.ToolCall, Usage, error) {
+	var content bytes.Buffer
+	var usage Usage
+	finished := false // 是否收到了 finish_reason
+	acc := newToolCallAccumulator()
+
+	err := readSSE(r, func(data []byte) error {
+		var chunk streamChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to parse stream chunk: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.toUsage()
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				finished = true
+			}
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				if onDelta != nil {
+					onDelta(choice.Delta.Content)
+				}
+			}
+			for _, d := range choice.Delta.ToolCalls {
+				acc.add(d)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, io.ErrUnexpectedEOF) && finished {
+		// 部分兼容接口在 finish_reason 之后直接关闭连接，不发送 [DONE]
+		err = nil
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", nil, Usage{}, fmt.Errorf("stream ended before [DONE] or finish_reason: %w", err)
+	}
+	if err != nil {
+		return "", nil, Usage{}, err
+	}
+
+	return content.String(), acc.result(), usage, nil
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseChatStream(t *testing.T) {
+	stream := strings.Join([]string{
+		": keep-alive",
+		"",
+		`data: {"choices":[{"delta":{"content":"It is "}}]}`,
+		"",
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_current_time","arguments":"{\"tz\":"}}]}}]}`,
+		"",
+		`data: {"choices":[{"delta":{"content":"noon.","tool_calls":[{"index":0,"function":{"arguments":"\"UTC\"}"}}]}}]}`,
+		"",
+		`data: {"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+		"",
+		"data: [DONE]",
+		"",
+		`data: {"choices":[{"delta":{"content":" ignored"}}]}`,
+		"",
+	}, "\r\n")
+
+	var deltas []string
+	content, calls, usage, err := parseChatStream(strings.NewReader(stream), func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "It is noon." || len(deltas) != 2 {
+		t.Errorf("content = %q, deltas = %q", content, deltas)
+	}
+	if len(calls) != 1 || calls[0].ID != "call_1" || calls[0].Function.Arguments != `{"tz":"UTC"}` {
+		t.Errorf("tool calls = %+v", calls)
+	}
+	if usage.TotalTokens() != 15 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestParseChatStreamInvalidChunk(t *testing.T) {
+	_, _, _, err := parseChatStream(strings.NewReader("data: {not json\n\n"), nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to parse stream chunk") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestParseChatStreamCompletion(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		err    string // 为空时应成功
+	}{
+		{
+			name:   "done marker",
+			stream: "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n",
+		},
+		{
+			name:   "finish_reason without done marker",
+			stream: "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"},\"finish_reason\":\"stop\"}]}\n\n",
+		},
+		{
+			name:   "cut off mid-reply",
+			stream: "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n",
+			err:    "stream ended before [DONE] or finish_reason",
+		},
+		{
+			name:   "cut off mid-tool-call",
+			stream: "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"function\":{\"name\":\"get_time\",\"arguments\":\"{\\\"tz\"}}]}}]}\n\n",
+			err:    "stream ended before [DONE] or finish_reason",
+		},
+		{
+			name:   "empty body",
+			stream: "",
+			err:    "stream ended before [DONE] or finish_reason",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, _, _, err := parseChatStream(strings.NewReader(tt.stream), nil)
+			if tt.err == "" {
+				if err != nil || content != "hi" {
+					t.Fatalf("got %q, %v; want hi", content, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package model
+
+// Usage 记录一次或多次模型请求消耗的 token 数
+type Usage struct {
+	PromptTokens       int // 输入 token 数（包含命中缓存的部分）
+	CompletionTokens   int // 输出 token 数
+	CachedPromptTokens int // 命中提示缓存的输入 token 数
+}
+
+// TotalTokens 返回输入与输出 token 的总数
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Add 将另一份用量累加到 u 上
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.CachedPromptTokens += other.CachedPromptTokens
+}
+
+// openAIUsage 是 OpenAI 兼容接口返回的 usage 结构
+// DeepSeek 使用 prompt_cache_hit_tokens 表示缓存命中，OpenAI 使用 prompt_tokens_details.cached_tokens
+type openAIUsage struct {
+	PromptTokens         int `json:"prompt_tokens"`
+	CompletionTokens     int `json:"completion_tokens"`
+	PromptCacheHitTokens int `json:"prompt_cache_hit_tokens"`
+	PromptTokensDetails  struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+// toUsage 转换为统一的 Usage
+func (u *openAIUsage) toUsage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	cached := u.PromptTokensDetails.CachedTokens
+	if cached == 0 {
+		cached = u.PromptCacheHitTokens
+	}
+	return Usage{
+		PromptTokens:       u.PromptTokens,
+		CompletionTokens:   u.CompletionTokens,
+		CachedPromptTokens: cached,
+	}
+}
@@ -0,0 +1,103 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// JSONRPCVersion 是 JSON-RPC 信封中固定的版本号
+const JSONRPCVersion = "2.0"
+
+// JSON-RPC 2.0 标准错误码
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// JSONRPCRequest 是发出的请求或通知，ID 为空时表示通知（不需要响应）
+type JSONRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  interface{}     `json:"params,omitempty"`
+}
+
+// JSONRPCResponse 是发出的响应，Result 与 Error 二者只能有一个
+type JSONRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+}
+
+// JSONRPCMessage 用于解码收到的任意消息：请求、通知或响应
+type JSONRPCMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+}
+
+// IsRequest 判断消息是否为需要响应的请求
+func (m *JSONRPCMessage) IsRequest() bool {
+	return m.Method != "" && len(m.ID) > 0 && string(m.ID) != "null"
+}
+
+// IsNotification 判断消息是否为通知
+func (m *JSONRPCMessage) IsNotification() bool {
+	return m.Method != "" && (len(m.ID) == 0 || string(m.ID) == "null")
+}
+
+// IsResponse 判断消息是否为响应
+func (m *JSONRPCMessage) IsResponse() bool {
+	return m.Method == "" && (m.Result != nil || m.Error != nil)
+}
+
+// JSONRPCError 是 JSON-RPC 错误对象
+type JSONRPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// Error 实现 error 接口
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// IntID 将整数编码为 JSON-RPC 请求 ID
+func IntID(id int64) json.RawMessage {
+	return json.RawMessage(strconv.FormatInt(id, 10))
+}
+
+// NullID 是无法确定请求 ID 时（如解析错误）响应中使用的 ID
+var NullID = json.RawMessage("null")
+
+// NewRequest 构造一个带 ID 的请求
+func NewRequest(id json.RawMessage, method string, params interface{}) JSONRPCRequest {
+	return JSONRPCRequest{JSONRPC: JSONRPCVersion, ID: id, Method: method, Params: params}
+}
+
+// NewNotification 构造一个通知
+func NewNotification(method string, params interface{}) JSONRPCRequest {
+	return JSONRPCRequest{JSONRPC: JSONRPCVersion, Method: method, Params: params}
+}
+
+// NewResult 构造一个成功响应
+func NewResult(id json.RawMessage, result interface{}) JSONRPCResponse {
+	return JSONRPCResponse{JSONRPC: JSONRPCVersion, ID: id, Result: result}
+}
+
+// NewErrorResponse 构造一个错误响应
+func NewErrorResponse(id json.RawMessage, code int, message string) JSONRPCResponse {
+	if len(id) == 0 {
+		id = NullID
+	}
+	return JSONRPCResponse{JSONRPC: JSONRPCVersion, ID: id, Error: &JSONRPCError{Code: code, Message: message}}
+}
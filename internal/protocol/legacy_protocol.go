@@ -0,0 +1,41 @@
+package protocol
+
+import "github.com/windlant/mcp-client/internal/tools"
+
+// 旧版自定义协议（按行传输的 {"method":"list_tools"} / {"method":"call_tool"}），
+// 不属于 MCP 规范，仅为兼容早期版本的服务器保留
+
+// 旧版协议方法常量
+const (
+	MCPMethodListTools = "list_tools"
+	MCPMethodCallTool  = "call_tool"
+	MCPMethodCancel    = "cancel" // 客户端放弃等待当前请求，服务器不对其作出响应
+)
+
+// 旧版协议请求结构
+
+type MCPListToolsRequest struct {
+	Method string `json:"method"` // 必须为 "list_tools"
+}
+
+type MCPToolCallRequest struct {
+	Method string                 `json:"method"` // 必须为 "call_tool"
+	Name   string                 `json:"name"`
+	Args   map[string]interface{} `json:"arguments"`
+}
+
+// MCPCancelRequest 通知服务器客户端已取消正在进行的请求
+type MCPCancelRequest struct {
+	Method string `json:"method"` // 必须为 "cancel"
+}
+
+// 旧版协议响应结构
+
+type MCPListToolsResponse struct {
+	Tools []tools.ToolDefinition `json:"tools"`
+}
+
+type MCPToolCallResponse struct {
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
@@ -1,32 +1,225 @@
 package protocol
 
-import "github.com/windlant/mcp-client/internal/tools"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// LatestProtocolVersion 是本实现优先使用的 MCP 协议版本
+const LatestProtocolVersion = "2025-06-18"
+
+// SupportedProtocolVersions 是本实现能够使用的全部 MCP 协议版本，从新到旧排列
+var SupportedProtocolVersions = []string{
+	"2025-06-18",
+	"2025-03-26",
+	"2024-11-05",
+}
+
+// IsSupportedProtocolVersion 判断协议版本是否受支持
+func IsSupportedProtocolVersion(version string) bool {
+	for _, v := range SupportedProtocolVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
 
 // MCP 方法常量
 const (
-	MCPMethodListTools = "list_tools"
-	MCPMethodCallTool  = "call_tool"
+	MethodInitialize       = "initialize"
+	MethodPing             = "ping"
+	MethodToolsList        = "tools/list"
+	MethodToolsCall        = "tools/call"
+	MethodInitialized      = "notifications/initialized"
+	MethodCancelled        = "notifications/cancelled"
+	MethodToolsListChanged = "notifications/tools/list_changed"
 )
 
-// MCP 请求结构
+// Implementation 描述客户端或服务器的名称与版本
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// ClientCapabilities 是客户端在握手时声明的能力，本客户端目前只使用工具，不声明 roots/sampling
+type ClientCapabilities struct {
+	Experimental map[string]interface{} `json:"experimental,omitempty"`
+}
+
+// ServerCapabilities 是服务器在握手时声明的能力
+type ServerCapabilities struct {
+	Tools        *ToolsCapability       `json:"tools,omitempty"`
+	Prompts      map[string]interface{} `json:"prompts,omitempty"`
+	Resources    map[string]interface{} `json:"resources,omitempty"`
+	Logging      map[string]interface{} `json:"logging,omitempty"`
+	Experimental map[string]interface{} `json:"experimental,omitempty"`
+}
+
+// ToolsCapability 描述服务器的工具能力
+type ToolsCapability struct {
+	ListChanged bool `json:"listChanged,omitempty"` // 工具列表变化时服务器是否发送通知
+}
+
+// InitializeParams 是 initialize 请求的参数
+type InitializeParams struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ClientCapabilities `json:"capabilities"`
+	ClientInfo      Implementation     `json:"clientInfo"`
+}
+
+// InitializeResult 是 initialize 请求的结果
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      Implementation     `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
+}
+
+// Tool 是 tools/list 返回的工具描述
+type Tool struct {
+	Name        string           `json:"name"`
+	Title       string           `json:"title,omitempty"`
+	Description string           `json:"description,omitempty"`
+	InputSchema tools.Schema     `json:"inputSchema"`
+	Annotations *ToolAnnotations `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations 是服务器对工具行为的提示，未设置的字段按规范取默认值
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    *bool  `json:"readOnlyHint,omitempty"`    // 工具是否不修改任何状态，默认 false
+	DestructiveHint *bool  `json:"destructiveHint,omitempty"` // 工具是否可能进行破坏性修改，默认 true，仅在 readOnlyHint 为 false 时有意义
+	IdempotentHint  *bool  `json:"idempotentHint,omitempty"`  // 以相同参数重复调用是否没有额外影响，默认 false
+	OpenWorldHint   *bool  `json:"openWorldHint,omitempty"`   // 工具是否与外部世界交互，默认 true
+}
+
+// ToolDefinition 将 MCP 工具描述转换为内部的工具定义
+func (t Tool) ToolDefinition() tools.ToolDefinition {
+	def := tools.ToolDefinition{
+		Name:        t.Name,
+		Description: t.Description,
+		Parameters:  t.InputSchema,
+	}
+	if a := t.Annotations; a != nil {
+		def.ReadOnly = isTrue(a.ReadOnlyHint)
+		// 只根据服务器明确给出的提示判断：声明了会修改状态（readOnlyHint: false）或可能有破坏性（destructiveHint: true）
+		// 的工具不与其他调用并行执行；没有提示的工具保持可并行，需要时可在配置的 tools.sequential 中指定
+		def.Sequential = !def.ReadOnly && (isFalse(a.ReadOnlyHint) || isTrue(a.DestructiveHint))
+	}
+	return def
+}
+
+// AnnotationsFor 根据内部工具定义生成 MCP 工具提示，没有可提示的信息时返回 nil
+func AnnotationsFor(def tools.ToolDefinition) *ToolAnnotations {
+	switch {
+	case def.ReadOnly:
+		readOnly := true
+		return &ToolAnnotations{ReadOnlyHint: &readOnly}
+	case def.Sequential:
+		readOnly := false
+		return &ToolAnnotations{ReadOnlyHint: &readOnly}
+	default:
+		return nil
+	}
+}
+
+func isTrue(b *bool) bool  { return b != nil && *b }
+func isFalse(b *bool) bool { return b != nil && !*b }
+
+// ListToolsParams 是 tools/list 请求的参数
+type ListToolsParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// ListToolsResult 是 tools/list 请求的结果，NextCursor 非空时还有下一页
+type ListToolsResult struct {
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// CallToolParams 是 tools/call 请求的参数
+type CallToolParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// CallToolResult 是 tools/call 请求的结果；工具执行失败时 IsError 为 true，
+// 错误信息放在 Content 中交给模型，而不是作为 JSON-RPC 错误返回
+type CallToolResult struct {
+	Content           []Content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError,omitempty"`
+}
 
-type MCPListToolsRequest struct {
-	Method string `json:"method"` // 必须为 "list_tools"
+// Text 将结果中的内容块拼接为文本，非文本内容以占位说明代替
+func (r CallToolResult) Text() string {
+	parts := make([]string, 0, len(r.Content))
+	for _, c := range r.Content {
+		parts = append(parts, c.String())
+	}
+	if len(parts) == 0 && len(r.StructuredContent) > 0 {
+		return string(r.StructuredContent)
+	}
+	return strings.Join(parts, "\n")
 }
 
-type MCPToolCallRequest struct {
-	Method string                 `json:"method"` // 必须为 "call_tool"
-	Name   string                 `json:"name"`
-	Args   map[string]interface{} `json:"arguments"`
+// Content 类型常量
+const (
+	ContentText         = "text"
+	ContentImage        = "image"
+	ContentAudio        = "audio"
+	ContentResource     = "resource"
+	ContentResourceLink = "resource_link"
+)
+
+// Content 是工具结果中的一个内容块
+type Content struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`     // text
+	Data     string          `json:"data,omitempty"`     // image/audio，base64 编码
+	MimeType string          `json:"mimeType,omitempty"` // image/audio/resource_link
+	URI      string          `json:"uri,omitempty"`      // resource_link
+	Name     string          `json:"name,omitempty"`     // resource_link
+	Resource json.RawMessage `json:"resource,omitempty"` // resource（嵌入的资源）
 }
 
-// MCP 响应结构
+// TextContent 构造一个文本内容块
+func TextContent(text string) Content {
+	return Content{Type: ContentText, Text: text}
+}
 
-type MCPListToolsResponse struct {
-	Tools []tools.ToolDefinition `json:"tools"`
+// String 返回内容块的文本表示
+func (c Content) String() string {
+	switch c.Type {
+	case ContentText:
+		return c.Text
+	case ContentImage, ContentAudio:
+		return fmt.Sprintf("[%s content: %s, %d bytes base64]", c.Type, c.MimeType, len(c.Data))
+	case ContentResourceLink:
+		return fmt.Sprintf("[resource link: %s %s]", c.Name, c.URI)
+	case ContentResource:
+		var res struct {
+			URI  string `json:"uri"`
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(c.Resource, &res); err == nil && res.Text != "" {
+			return res.Text
+		}
+		return fmt.Sprintf("[resource: %s]", res.URI)
+	default:
+		return fmt.Sprintf("[%s content]", c.Type)
+	}
 }
 
-type MCPToolCallResponse struct {
-	Result string `json:"result"`
-	Error  string `json:"error,omitempty"`
+// CancelledParams 是 notifications/cancelled 通知的参数
+type CancelledParams struct {
+	RequestID json.RawMessage `json:"requestId"`
+	Reason    string          `json:"reason,omitempty"`
 }
+
+// ClientInfo 是本客户端在 initialize 握手中上报的实现信息
+var ClientInfo = Implementation{Name: "mcp-client", Version: "0.1.0"}
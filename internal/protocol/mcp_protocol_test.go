@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+func TestToolDefinitionFromAnnotations(t *testing.T) {
+	for _, tc := range []struct {
+		annotations          string
+		sequential, readOnly bool
+	}{
+		{``, false, false},
+		{`"annotations": {}`, false, false},
+		{`"annotations": {"readOnlyHint": true}`, false, true},
+		{`"annotations": {"readOnlyHint": true, "destructiveHint": true}`, false, true},
+		{`"annotations": {"readOnlyHint": false}`, true, false},
+		{`"annotations": {"readOnlyHint": false, "destructiveHint": false}`, true, false},
+		{`"annotations": {"destructiveHint": true}`, true, false},
+		{`"annotations": {"idempotentHint": true, "openWorldHint": false}`, false, false},
+	} {
+		data := `{"name": "t", "inputSchema": {"type": "object"}`
+		if tc.annotations != "" {
+			data += ", " + tc.annotations
+		}
+		data += "}"
+
+		var tool Tool
+		if err := json.Unmarshal([]byte(data), &tool); err != nil {
+			t.Fatalf("%s: %v", data, err)
+		}
+		def := tool.ToolDefinition()
+		if def.Sequential != tc.sequential || def.ReadOnly != tc.readOnly {
+			t.Errorf("%s: Sequential=%v ReadOnly=%v, want %v %v", tc.annotations, def.Sequential, def.ReadOnly, tc.sequential, tc.readOnly)
+		}
+	}
+}
+
+func TestAnnotationsRoundTrip(t *testing.T) {
+	for _, def := range []tools.ToolDefinition{
+		{Name: "read", ReadOnly: true},
+		{Name: "write", Sequential: true},
+		{Name: "plain"},
+	} {
+		tool := Tool{Name: def.Name, Annotations: AnnotationsFor(def)}
+		data, err := json.Marshal(tool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Tool
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		got := decoded.ToolDefinition()
+		if got.Sequential != def.Sequential || got.ReadOnly != def.ReadOnly {
+			t.Errorf("%s: %s decoded as Sequential=%v ReadOnly=%v", def.Name, data, got.Sequential, got.ReadOnly)
+		}
+	}
+}
@@ -7,6 +7,7 @@ type Message struct {
 	Name       string     `json:"name,omitempty"`         // 用于 tool 消息，标识工具名称
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // 助手发起的工具调用列表
 	ToolCallID string     `json:"tool_call_id,omitempty"` // 工具响应对应的调用 ID
+	IsError    bool       `json:"-"`                      // tool 消息对应的工具调用是否失败；OpenAI 兼容接口没有该字段，不参与序列化
 }
 
 // ToolCall 表示模型发起的一次函数/工具调用请求
@@ -0,0 +1,137 @@
+// Package sse 读取 Server-Sent Events（text/event-stream）流，供模型流式响应与远程 MCP 传输共用
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxLineSize 是单行的最大长度，工具结果等大消息可能整个放在一行 data 中
+const maxLineSize = 16 * 1024 * 1024
+
+// Event 是流中的一个事件
+type Event struct {
+	ID    string        // id 字段，用于断线后通过 Last-Event-ID 续传；事件块中没有 id 时为空
+	Event string        // event 字段，缺省为 "message"
+	Data  string        // 多行 data 以换行拼接
+	Retry time.Duration // retry 字段，服务器建议的重连间隔；没有时为 0
+}
+
+// Reader 按 text/event-stream 格式逐个读取事件
+// 行可以以 LF、CRLF 或单独的 CR 结尾；以冒号开头的注释行（常用作心跳）被忽略；
+// 没有冒号的行整行作为字段名、值为空，未知字段被忽略
+type Reader struct {
+	scanner *bufio.Scanner
+	skipLF  bool // 上一行以 CR 结尾，下一个字节若是 LF 则属于同一个换行
+	started bool // 是否已读过第一行，第一行开头的 BOM 需要去掉
+}
+
+// NewReader 创建一个读取 r 中事件的读取器
+func NewReader(r io.Reader) *Reader {
+	reader := &Reader{scanner: bufio.NewScanner(r)}
+	reader.scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	reader.scanner.Split(reader.scanLines)
+	return reader
+}
+
+// Next 返回下一个事件；流结束时返回 io.EOF
+// 只有注释或 event 字段、没有 data 的事件块会被跳过，但带有 id 或 retry 的事件块仍会返回，便于调用方更新续传位置；
+// 流在事件中途结束时，按规范丢弃不完整的事件
+func (r *Reader) Next() (Event, error) {
+	var ev Event
+	var data []string
+	hasData := false
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if !r.started {
+			r.started = true
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		if line == "" {
+			// 空行表示一个事件结束
+			if hasData || ev.ID != "" || ev.Retry > 0 {
+				ev.Data = strings.Join(data, "\n")
+				if ev.Event == "" {
+					ev.Event = "message"
+				}
+				return ev, nil
+			}
+			ev, data = Event{}, nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			// 按规范忽略含 NUL 的 id
+			if !strings.ContainsRune(value, 0) {
+				ev.ID = value
+			}
+		case "event":
+			ev.Event = value
+		case "data":
+			data = append(data, value)
+			hasData = true
+		case "retry":
+			if ms, ok := parseRetry(value); ok {
+				ev.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
+
+// parseRetry 解析只由 ASCII 数字组成的 retry 值
+func parseRetry(value string) (int64, bool) {
+	if value == "" || len(value) > 12 {
+		return 0, false
+	}
+	var ms int64
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		ms = ms*10 + int64(c-'0')
+	}
+	return ms, true
+}
+
+// scanLines 是按 LF、CRLF 或单独的 CR 分行的 bufio.SplitFunc
+// 行尾的 CR 不等待下一个字节就返回，避免只用 CR 换行的流在事件结束后停住；随后到达的 LF 被跳过
+func (r *Reader) scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if r.skipLF && len(data) > 0 {
+		r.skipLF = false
+		if data[0] == '\n' {
+			return 1, nil, nil
+		}
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		r.skipLF = true
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,120 @@
+package sse
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// readAll 读取 stream 中的全部事件
+func readAll(t *testing.T, r io.Reader) []Event {
+	t.Helper()
+	reader := NewReader(r)
+	var events []Event
+	for {
+		ev, err := reader.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+}
+
+func TestReaderEvents(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		stream string
+		want   []Event
+	}{
+		{
+			name:   "single data line",
+			stream: "data: hello\n\n",
+			want:   []Event{{Event: "message", Data: "hello"}},
+		},
+		{
+			name:   "multi-line data",
+			stream: "data: {\"a\":\ndata:  1}\ndata\n\n",
+			want:   []Event{{Event: "message", Data: "{\"a\":\n 1}\n"}},
+		},
+		{
+			name:   "event, id and retry fields",
+			stream: "event: endpoint\nid: 7\nretry: 1500\ndata: /messages?s=1\n\n",
+			want:   []Event{{ID: "7", Event: "endpoint", Data: "/messages?s=1", Retry: 1500 * time.Millisecond}},
+		},
+		{
+			name:   "comments and unknown fields are ignored",
+			stream: ": ping\n\n:keep-alive\nfoo: bar\ndata: x\n: inside\n\n",
+			want:   []Event{{Event: "message", Data: "x"}},
+		},
+		{
+			name:   "blocks with only an id or retry are returned",
+			stream: "id: 3\n\nretry: 100\n\nevent: ping\n\n",
+			want:   []Event{{ID: "3", Event: "message"}, {Event: "message", Retry: 100 * time.Millisecond}},
+		},
+		{
+			name:   "invalid retry and id with NUL are ignored",
+			stream: "retry: 1.5s\nid: a\x00b\ndata: x\n\n",
+			want:   []Event{{Event: "message", Data: "x"}},
+		},
+		{
+			name:   "CRLF line endings",
+			stream: "event: message\r\ndata: a\r\ndata: b\r\n\r\ndata: c\r\n\r\n",
+			want:   []Event{{Event: "message", Data: "a\nb"}, {Event: "message", Data: "c"}},
+		},
+		{
+			name:   "CR line endings",
+			stream: "data: a\rdata: b\r\rdata: c\r\r",
+			want:   []Event{{Event: "message", Data: "a\nb"}, {Event: "message", Data: "c"}},
+		},
+		{
+			name:   "leading BOM",
+			stream: "\ufeffdata: x\n\n",
+			want:   []Event{{Event: "message", Data: "x"}},
+		},
+		{
+			name:   "incomplete trailing event is dropped",
+			stream: "data: done\n\ndata: partial",
+			want:   []Event{{Event: "message", Data: "done"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := readAll(t, strings.NewReader(tc.stream))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %+v\nwant %+v", got, tc.want)
+			}
+			// 逐字节到达时（CRLF 被拆在两次读取之间）结果相同
+			got = readAll(t, iotest.OneByteReader(strings.NewReader(tc.stream)))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("one byte at a time: got %+v\nwant %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReaderLargeLine(t *testing.T) {
+	data := strings.Repeat("x", 1<<20)
+	got := readAll(t, strings.NewReader("data: "+data+"\n\n"))
+	if len(got) != 1 || got[0].Data != data {
+		t.Fatalf("large data line not read intact")
+	}
+}
+
+func TestReaderPropagatesReadErrors(t *testing.T) {
+	errBroken := errors.New("connection reset")
+	r := io.MultiReader(strings.NewReader("data: a\n\ndata: b\n"), iotest.ErrReader(errBroken))
+	reader := NewReader(r)
+
+	if ev, err := reader.Next(); err != nil || ev.Data != "a" {
+		t.Fatalf("got %+v, %v", ev, err)
+	}
+	if _, err := reader.Next(); !errors.Is(err, errBroken) {
+		t.Fatalf("got %v, want the read error", err)
+	}
+}
@@ -1,16 +1,18 @@
 package tools
 
 import (
+	"context"
 	"errors"
 )
 
 // ToolClient 是工具调用的统一接口，支持本地或远程（如 stdio、HTTP）实现
+// Call 与 List 应在 ctx 被取消时尽快返回 ctx.Err()
 type ToolClient interface {
 	// Call 调用指定名称的工具，并传入参数
-	Call(name string, args ToolArguments) (string, error)
+	Call(ctx context.Context, name string, args ToolArguments) (string, error)
 
 	// List 返回所有可用工具的定义
-	List() ([]ToolDefinition, error)
+	List(ctx context.Context) ([]ToolDefinition, error)
 
 	// Close 释放资源（如关闭子进程或网络连接）
 	Close() error
@@ -0,0 +1,184 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// NameSeparator 分隔服务器名与工具名，用于区分多个服务器中同名的工具，例如 "fs__read_file"
+const NameSeparator = "__"
+
+// route 记录对外暴露的工具名对应的服务器与原始工具名
+type route struct {
+	server string
+	name   string
+}
+
+// member 是聚合中的一个工具服务器
+type member struct {
+	name   string
+	client tools.ToolClient
+}
+
+// CompositeToolClient 将多个工具客户端（通常是多个 MCP 服务器）聚合为一个 ToolClient：
+// List 合并所有服务器的工具，Call 按工具名路由到对应的服务器。
+// 只在一个服务器中出现的工具保留原名，多个服务器中同名的工具改为 "服务器名__工具名"；
+// 某个服务器获取工具列表失败时沿用它上一次成功获取的列表，已经暴露给模型的工具名与路由不会因此改变
+type CompositeToolClient struct {
+	members []member
+	onError func(server string, err error)
+
+	mu        sync.RWMutex
+	lastTools map[string][]tools.ToolDefinition // 各服务器最近一次成功获取的工具列表
+	routes    map[string]route                  // 对外暴露的工具名 -> 路由，工具列表更新时重建
+}
+
+// NewCompositeToolClient 创建一个空的聚合工具客户端
+func NewCompositeToolClient() *CompositeToolClient {
+	return &CompositeToolClient{
+		lastTools: make(map[string][]tools.ToolDefinition),
+		routes:    make(map[string]route),
+	}
+}
+
+// Add 加入一个名为 name 的工具服务器，名称用于解决工具重名并出现在错误信息中
+func (c *CompositeToolClient) Add(name string, client tools.ToolClient) {
+	c.members = append(c.members, member{name: name, client: client})
+}
+
+// SetErrorHandler 设置某个服务器获取工具列表失败时的回调
+// 单个服务器失败不会让 List 整体失败，该服务器沿用上一次成功获取的工具，从未成功过时在本次列表中缺席
+func (c *CompositeToolClient) SetErrorHandler(fn func(server string, err error)) {
+	c.onError = fn
+}
+
+// Len 返回已加入的服务器数量
+func (c *CompositeToolClient) Len() int {
+	return len(c.members)
+}
+
+// List 并发获取所有服务器的工具定义，合并后返回，并更新工具名到服务器的路由
+// 只有全部服务器都失败时才返回错误
+func (c *CompositeToolClient) List(ctx context.Context) ([]tools.ToolDefinition, error) {
+	results := make([][]tools.ToolDefinition, len(c.members))
+	errs := make([]error, len(c.members))
+
+	var wg sync.WaitGroup
+	for i, m := range c.members {
+		wg.Add(1)
+		go func(i int, m member) {
+			defer wg.Done()
+			results[i], errs[i] = m.client.List(ctx)
+		}(i, m)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	failed := 0
+	for i, m := range c.members {
+		if errs[i] != nil {
+			failed++
+			if c.onError != nil {
+				c.onError(m.name, errs[i])
+			}
+			errs[i] = fmt.Errorf("server %s: %w", m.name, errs[i])
+		}
+	}
+	if failed > 0 && failed == len(c.members) {
+		return nil, fmt.Errorf("all %d tool servers failed to list tools: %w", failed, errors.Join(errs...))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, m := range c.members {
+		if errs[i] == nil {
+			c.lastTools[m.name] = results[i]
+		}
+	}
+	return c.rebuildLocked(), nil
+}
+
+// SetTools 用服务器 server 的最新工具列表（例如服务器重启后重新获取的列表）更新路由，不必等到下一次 List
+func (c *CompositeToolClient) SetTools(server string, defs []tools.ToolDefinition) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastTools[server] = defs
+	c.rebuildLocked()
+}
+
+// rebuildLocked 根据各服务器的工具列表重建路由，返回合并后按名称排序的工具定义；调用方需持有 mu
+func (c *CompositeToolClient) rebuildLocked() []tools.ToolDefinition {
+	// 统计每个工具名出现在几个服务器中
+	count := make(map[string]int)
+	for _, m := range c.members {
+		for _, def := range c.lastTools[m.name] {
+			count[def.Name]++
+		}
+	}
+
+	routes := make(map[string]route)
+	var defs []tools.ToolDefinition
+	for _, m := range c.members {
+		for _, def := range c.lastTools[m.name] {
+			exposed := def.Name
+			if count[def.Name] > 1 {
+				exposed = m.name + NameSeparator + def.Name
+			}
+			routes[exposed] = route{server: m.name, name: def.Name}
+
+			def.Name = exposed
+			defs = append(defs, def)
+		}
+	}
+	sort.SliceStable(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+
+	c.routes = routes
+	return defs
+}
+
+// Call 将工具调用路由到提供该工具的服务器；尚未获取过工具列表时先获取一次
+func (c *CompositeToolClient) Call(ctx context.Context, name string, args tools.ToolArguments) (string, error) {
+	r, ok := c.lookup(name)
+	if !ok {
+		if _, err := c.List(ctx); err != nil {
+			return "", err
+		}
+		if r, ok = c.lookup(name); !ok {
+			return "", fmt.Errorf("%w: %s", tools.ErrToolNotFound, name)
+		}
+	}
+
+	for _, m := range c.members {
+		if m.name == r.server {
+			return m.client.Call(ctx, r.name, args)
+		}
+	}
+	return "", fmt.Errorf("%w: %s", tools.ErrToolNotFound, name)
+}
+
+// lookup 查找对外暴露的工具名对应的路由
+func (c *CompositeToolClient) lookup(name string) (route, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r, ok := c.routes[name]
+	return r, ok
+}
+
+// Close 关闭所有服务器，返回遇到的全部错误
+func (c *CompositeToolClient) Close() error {
+	var errs []error
+	for _, m := range c.members {
+		if err := m.client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("server %s: %w", m.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
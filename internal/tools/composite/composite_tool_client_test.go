@@ -0,0 +1,191 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// fakeClient 是测试用的工具服务器：List 返回 names 对应的工具（listErr 非空时失败），Call 记录收到的工具名
+type fakeClient struct {
+	mu      sync.Mutex
+	names   []string
+	listErr error
+	calls   []string
+}
+
+func (f *fakeClient) List(ctx context.Context) ([]tools.ToolDefinition, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+	defs := make([]tools.ToolDefinition, 0, len(f.names))
+	for _, name := range f.names {
+		defs = append(defs, tools.ToolDefinition{Name: name})
+	}
+	return defs, nil
+}
+
+func (f *fakeClient) Call(ctx context.Context, name string, args tools.ToolArguments) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, name)
+	return "called " + name, nil
+}
+
+func (f *fakeClient) Close() error { return nil }
+
+func (f *fakeClient) setListErr(err error) {
+	f.mu.Lock()
+	f.listErr = err
+	f.mu.Unlock()
+}
+
+func (f *fakeClient) called() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func toolNames(defs []tools.ToolDefinition) []string {
+	names := make([]string, 0, len(defs))
+	for _, def := range defs {
+		names = append(names, def.Name)
+	}
+	return names
+}
+
+func listNames(t *testing.T, c *CompositeToolClient) []string {
+	t.Helper()
+	defs, err := c.List(context.Background())
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	return toolNames(defs)
+}
+
+func TestListPrefixesOnlyCollidingNames(t *testing.T) {
+	c := NewCompositeToolClient()
+	c.Add("fs", &fakeClient{names: []string{"read_file", "search"}})
+	c.Add("web", &fakeClient{names: []string{"fetch", "search"}})
+
+	got := listNames(t, c)
+	want := []string{"fetch", "fs__search", "read_file", "web__search"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tools = %v, want %v", got, want)
+	}
+}
+
+func TestCallRoutesToOwningServer(t *testing.T) {
+	fs := &fakeClient{names: []string{"read_file", "search"}}
+	web := &fakeClient{names: []string{"fetch", "search"}}
+	c := NewCompositeToolClient()
+	c.Add("fs", fs)
+	c.Add("web", web)
+
+	// 尚未 List 时 Call 先获取一次工具列表
+	for _, name := range []string{"web__search", "read_file", "fs__search", "fetch"} {
+		if _, err := c.Call(context.Background(), name, nil); err != nil {
+			t.Fatalf("Call(%s) failed: %v", name, err)
+		}
+	}
+
+	if got, want := fs.called(), []string{"read_file", "search"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fs received %v, want %v", got, want)
+	}
+	if got, want := web.called(), []string{"search", "fetch"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("web received %v, want %v", got, want)
+	}
+
+	_, err := c.Call(context.Background(), "search", nil)
+	if !errors.Is(err, tools.ErrToolNotFound) {
+		t.Errorf("Call(search) error = %v, want ErrToolNotFound", err)
+	}
+}
+
+func TestFailingServerKeepsLastToolSet(t *testing.T) {
+	fs := &fakeClient{names: []string{"read_file", "search"}}
+	web := &fakeClient{names: []string{"fetch", "search"}}
+	c := NewCompositeToolClient()
+	c.Add("fs", fs)
+	c.Add("web", web)
+
+	var failures []string
+	c.SetErrorHandler(func(server string, err error) {
+		failures = append(failures, server)
+	})
+
+	first := listNames(t, c)
+
+	web.setListErr(errors.New("connection refused"))
+	second := listNames(t, c)
+
+	if !reflect.DeepEqual(second, first) {
+		t.Errorf("tools after web failed = %v, want unchanged %v", second, first)
+	}
+	if want := []string{"web"}; !reflect.DeepEqual(failures, want) {
+		t.Errorf("error handler called for %v, want %v", failures, want)
+	}
+
+	// 已经暴露给模型的名称仍然路由到原来的服务器
+	if _, err := c.Call(context.Background(), "fs__search", nil); err != nil {
+		t.Fatalf("Call(fs__search) failed: %v", err)
+	}
+	if _, err := c.Call(context.Background(), "web__search", nil); err != nil {
+		t.Fatalf("Call(web__search) failed: %v", err)
+	}
+	if got, want := fs.called(), []string{"search"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fs received %v, want %v", got, want)
+	}
+	if got, want := web.called(), []string{"search"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("web received %v, want %v", got, want)
+	}
+}
+
+func TestServerThatNeverListedIsLeftOut(t *testing.T) {
+	c := NewCompositeToolClient()
+	c.Add("fs", &fakeClient{names: []string{"read_file"}})
+	c.Add("web", &fakeClient{listErr: errors.New("connection refused")})
+
+	got := listNames(t, c)
+	if want := []string{"read_file"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tools = %v, want %v", got, want)
+	}
+}
+
+func TestListFailsWhenAllServersFail(t *testing.T) {
+	c := NewCompositeToolClient()
+	c.Add("fs", &fakeClient{listErr: errors.New("broken pipe")})
+	c.Add("web", &fakeClient{listErr: errors.New("connection refused")})
+
+	if _, err := c.List(context.Background()); err == nil {
+		t.Fatal("List succeeded, want an error when every server fails")
+	}
+}
+
+func TestSetToolsRebuildsRoutes(t *testing.T) {
+	fs := &fakeClient{names: []string{"read_file"}}
+	web := &fakeClient{names: []string{"fetch"}}
+	c := NewCompositeToolClient()
+	c.Add("fs", fs)
+	c.Add("web", web)
+	listNames(t, c)
+
+	// web 重启后多了一个与 fs 同名的工具
+	c.SetTools("web", []tools.ToolDefinition{{Name: "fetch"}, {Name: "read_file"}})
+
+	if _, err := c.Call(context.Background(), "web__read_file", nil); err != nil {
+		t.Fatalf("Call(web__read_file) failed: %v", err)
+	}
+	if got, want := web.called(), []string{"read_file"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("web received %v, want %v", got, want)
+	}
+	if len(fs.called()) != 0 {
+		t.Errorf("fs received %v, want no calls", fs.called())
+	}
+}
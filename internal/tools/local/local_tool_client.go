@@ -1,6 +1,7 @@
 package local
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/windlant/mcp-client/internal/tools"
@@ -21,16 +22,36 @@ func NewLocalToolClient() *LocalToolClient {
 }
 
 // Call 根据名称调用已注册的工具，并传入参数
-func (c *LocalToolClient) Call(name string, args tools.ToolArguments) (string, error) {
+func (c *LocalToolClient) Call(ctx context.Context, name string, args tools.ToolArguments) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	def, ok := c.registry.Get(name)
 	if !ok {
 		return "", fmt.Errorf("tool not found: %s", name)
 	}
-	return def.Function(args)
+
+	// 工具函数不接收 ctx，无法中途停止：ctx 结束时立即返回，函数在后台执行完后结果被丢弃
+	type callResult struct {
+		result string
+		err    error
+	}
+	done := make(chan callResult, 1)
+	go func() {
+		result, err := def.Function(args)
+		done <- callResult{result: result, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.result, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
 }
 
 // List 返回所有已注册工具的定义列表
-func (c *LocalToolClient) List() ([]tools.ToolDefinition, error) {
+func (c *LocalToolClient) List(ctx context.Context) ([]tools.ToolDefinition, error) {
 	return c.registry.ListAll(), nil
 }
 
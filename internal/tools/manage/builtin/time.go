@@ -13,10 +13,11 @@ func GetTimeTool(args tools.ToolArguments) (string, error) {
 var GetTimeToolDef = tools.ToolDefinition{
 	Name:        "get_current_time",
 	Description: "Get the current date and time in 'YYYY-MM-DD HH:MM:SS' format.",
-	Parameters: tools.ToolSchema{
-		Type:       "object",
-		Properties: map[string]tools.ToolParameter{},
+	Parameters: tools.Schema{
+		Type:       tools.SchemaType{"object"},
+		Properties: map[string]*tools.Schema{},
 		Required:   []string{},
 	},
 	Function: GetTimeTool,
+	ReadOnly: true,
 }
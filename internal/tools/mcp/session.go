@@ -0,0 +1,110 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// Transport 是 MCP 客户端传输层（stdio、Streamable HTTP 等）需要提供的最小能力，
+// 握手、列出工具、调用工具等与传输无关的逻辑由本包在其上实现
+type Transport interface {
+	// Request 发送 JSON-RPC 请求并返回响应中的 result；JSON-RPC 错误以 *protocol.JSONRPCError 返回
+	Request(ctx context.Context, method string, params interface{}) (json.RawMessage, error)
+
+	// Notify 发送 JSON-RPC 通知，不等待响应
+	Notify(ctx context.Context, method string, params interface{}) error
+}
+
+// Initialize 完成 MCP 握手：协商协议版本、交换能力，并发送 initialized 通知
+func Initialize(ctx context.Context, t Transport) (protocol.InitializeResult, error) {
+	params := protocol.InitializeParams{
+		ProtocolVersion: protocol.LatestProtocolVersion,
+		ClientInfo:      protocol.ClientInfo,
+	}
+
+	var result protocol.InitializeResult
+	raw, err := t.Request(ctx, protocol.MethodInitialize, params)
+	if err != nil {
+		return result, fmt.Errorf("failed to initialize MCP session: %w", err)
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return result, fmt.Errorf("failed to parse initialize response: %w", err)
+	}
+	// 服务器不支持我们请求的版本时会返回它支持的版本，我们也不支持则无法继续
+	if !protocol.IsSupportedProtocolVersion(result.ProtocolVersion) {
+		return result, fmt.Errorf("unsupported MCP protocol version %q from server %s", result.ProtocolVersion, result.ServerInfo.Name)
+	}
+
+	if err := t.Notify(ctx, protocol.MethodInitialized, nil); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// ListTools 获取服务器支持的所有工具定义，自动处理分页
+func ListTools(ctx context.Context, t Transport) ([]tools.ToolDefinition, error) {
+	var defs []tools.ToolDefinition
+	cursor := ""
+	for {
+		raw, err := t.Request(ctx, protocol.MethodToolsList, protocol.ListToolsParams{Cursor: cursor})
+		if err != nil {
+			return nil, fmt.Errorf("failed to send tools/list request: %w", err)
+		}
+
+		var result protocol.ListToolsResult
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse tools/list response: %w", err)
+		}
+		for _, tool := range result.Tools {
+			defs = append(defs, tool.ToolDefinition())
+		}
+
+		if result.NextCursor == "" {
+			return defs, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool 调用指定名称的工具；工具返回 isError 或服务器返回 JSON-RPC 错误时返回 "tool error"
+func CallTool(ctx context.Context, t Transport, name string, args tools.ToolArguments) (string, error) {
+	params := protocol.CallToolParams{
+		Name:      name,
+		Arguments: args,
+	}
+
+	raw, err := t.Request(ctx, protocol.MethodToolsCall, params)
+	if err != nil {
+		var rpcErr *protocol.JSONRPCError
+		if errors.As(err, &rpcErr) {
+			return "", fmt.Errorf("tool error: %s", rpcErr.Message)
+		}
+		return "", err
+	}
+
+	var result protocol.CallToolResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", fmt.Errorf("failed to parse tools/call response: %w", err)
+	}
+
+	if result.IsError {
+		return "", fmt.Errorf("tool error: %s", result.Text())
+	}
+
+	return result.Text(), nil
+}
+
+// ServerRequestResponse 生成对服务器主动发来的请求的响应：支持 ping，其余方法回复 method not found
+func ServerRequestResponse(msg *protocol.JSONRPCMessage) protocol.JSONRPCResponse {
+	switch msg.Method {
+	case protocol.MethodPing:
+		return protocol.NewResult(msg.ID, struct{}{})
+	default:
+		return protocol.NewErrorResponse(msg.ID, protocol.CodeMethodNotFound, "method not found: "+msg.Method)
+	}
+}
@@ -0,0 +1,35 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// NewToolClient 自动识别 URL 使用的 MCP HTTP 传输并建立连接：
+// 先按 Streamable HTTP 发送 initialize 请求，服务器以 400、404 或 405 拒绝时，
+// 再按旧版 HTTP+SSE 传输 GET 该地址并等待 endpoint 事件
+func NewToolClient(opts Options) (tools.ToolClient, error) {
+	client, err := NewRemoteToolClient(opts)
+	if err == nil {
+		return client, nil
+	}
+
+	var se *statusError
+	if !errors.As(err, &se) {
+		return nil, err
+	}
+	switch se.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed:
+	default:
+		return nil, err
+	}
+
+	sseClient, sseErr := NewSSEToolClient(opts)
+	if sseErr != nil {
+		return nil, fmt.Errorf("server supports neither Streamable HTTP (%v) nor HTTP+SSE: %w", err, sseErr)
+	}
+	return sseClient, nil
+}
@@ -1 +1,424 @@
 package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/sse"
+	"github.com/windlant/mcp-client/internal/tools"
+	"github.com/windlant/mcp-client/internal/tools/mcp"
+)
+
+// Streamable HTTP 传输使用的请求头
+const (
+	HeaderSessionID       = "Mcp-Session-Id"
+	HeaderProtocolVersion = "MCP-Protocol-Version"
+	HeaderLastEventID     = "Last-Event-ID"
+)
+
+const (
+	initializeTimeout = 30 * time.Second // 等待服务器完成 initialize 握手的最长时间
+	notifyTimeout     = 5 * time.Second  // 发送取消通知等后台消息的最长时间
+	maxResumeAttempts = 3                // SSE 响应流中断后通过 Last-Event-ID 续传的最大次数
+)
+
+// errSessionExpired 表示服务器已不认识当前会话（HTTP 404），需要重新握手
+var errSessionExpired = errors.New("MCP session expired")
+
+// statusError 表示服务器以意外的 HTTP 状态码拒绝了请求
+type statusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+// newStatusError 读取响应体的开头部分并关闭响应，生成 statusError
+func newStatusError(resp *http.Response) *statusError {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &statusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(bytes.TrimSpace(body)),
+	}
+}
+
+// Error 实现 error 接口
+func (e *statusError) Error() string {
+	return fmt.Sprintf("MCP server returned %s: %s", e.Status, e.Body)
+}
+
+// Options 描述如何连接一个 Streamable HTTP MCP 服务器
+type Options struct {
+	URL        string            // MCP 端点地址，例如 "https://example.com/mcp"
+	Headers    map[string]string // 附加的请求头，例如 Authorization
+	HTTPClient *http.Client      // 为空时使用不设整体超时的客户端，请求期限由 ctx 控制
+}
+
+// RemoteToolClient 通过 MCP Streamable HTTP 传输与远程工具服务器通信：
+// 每条 JSON-RPC 消息单独 POST 到端点，服务器以 JSON 或 SSE 流返回响应
+type RemoteToolClient struct {
+	url        string
+	headers    map[string]string
+	httpClient *http.Client
+	nextID     int64 // 最近一次分配的请求 ID，原子递增
+
+	mu              sync.Mutex
+	sessionID       string // 服务器在握手时分配的会话 ID，为空表示服务器不使用会话
+	protocolVersion string // 握手协商出的协议版本
+	server          protocol.InitializeResult
+
+	reinitMu sync.Mutex // 会话过期后只允许一个调用方重新握手
+}
+
+// NewRemoteToolClient 连接一个 Streamable HTTP MCP 服务器并完成 initialize 握手
+func NewRemoteToolClient(opts Options) (*RemoteToolClient, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("server url is required")
+	}
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	client := &RemoteToolClient{
+		url:        opts.URL,
+		headers:    opts.Headers,
+		httpClient: httpClient,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), initializeTimeout)
+	defer cancel()
+	if err := client.initialize(ctx); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// initialize 丢弃当前会话并重新握手
+func (c *RemoteToolClient) initialize(ctx context.Context) error {
+	c.mu.Lock()
+	c.sessionID = ""
+	c.protocolVersion = ""
+	c.mu.Unlock()
+
+	server, err := mcp.Initialize(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.server = server
+	c.mu.Unlock()
+	return nil
+}
+
+// ServerInfo 返回握手时服务器上报的协议版本、能力与实现信息
+func (c *RemoteToolClient) ServerInfo() protocol.InitializeResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.server
+}
+
+// session 返回当前的会话 ID
+func (c *RemoteToolClient) session() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessionID
+}
+
+// Request 发送 JSON-RPC 请求并返回响应中的 result
+// 会话过期时自动重新握手并重试一次；ctx 被取消时向服务器发送 notifications/cancelled
+func (c *RemoteToolClient) Request(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	sessionID := c.session()
+	result, err := c.roundTrip(ctx, method, params)
+	if !errors.Is(err, errSessionExpired) || method == protocol.MethodInitialize {
+		return result, err
+	}
+
+	c.reinitMu.Lock()
+	// 其他调用方可能已经完成了重新握手，此时直接用新会话重试
+	var initErr error
+	if c.session() == sessionID {
+		initErr = c.initialize(ctx)
+	}
+	c.reinitMu.Unlock()
+	if initErr != nil {
+		return nil, fmt.Errorf("failed to re-initialize expired session: %w", initErr)
+	}
+	return c.roundTrip(ctx, method, params)
+}
+
+// roundTrip 发送一次请求并读取 JSON 或 SSE 格式的响应
+func (c *RemoteToolClient) roundTrip(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	id := protocol.IntID(atomic.AddInt64(&c.nextID, 1))
+	body, err := json.Marshal(protocol.NewRequest(id, method, params))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := c.post(ctx, body)
+	if err != nil {
+		return nil, c.canceled(ctx, id, method, err)
+	}
+
+	var result json.RawMessage
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		defer resp.Body.Close()
+		var msg protocol.JSONRPCMessage
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			return nil, c.canceled(ctx, id, method, fmt.Errorf("failed to parse response: %w", err))
+		}
+		if !msg.IsResponse() || string(msg.ID) != string(id) {
+			return nil, fmt.Errorf("unexpected response to %s request", method)
+		}
+		if result, err = resultOf(&msg); err != nil {
+			return nil, err
+		}
+	case "text/event-stream":
+		if result, err = c.readStream(ctx, resp.Body, id); err != nil {
+			return nil, c.canceled(ctx, id, method, err)
+		}
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	// 握手完成后，之后的每条消息（包括 initialized 通知）都要携带协商出的协议版本
+	if method == protocol.MethodInitialize {
+		var init protocol.InitializeResult
+		if json.Unmarshal(result, &init) == nil {
+			c.mu.Lock()
+			c.protocolVersion = init.ProtocolVersion
+			c.mu.Unlock()
+		}
+	}
+	return result, nil
+}
+
+// readStream 从 SSE 响应流中读取与 id 对应的响应，期间处理服务器发来的请求与通知
+// 流在响应到达前中断时，使用最后收到的事件 ID 发起 GET 请求续传；body 由本函数负责关闭
+func (c *RemoteToolClient) readStream(ctx context.Context, body io.ReadCloser, id json.RawMessage) (json.RawMessage, error) {
+	lastEventID := ""
+	for attempt := 0; ; attempt++ {
+		result, done, err := c.readEvents(body, id, &lastEventID)
+		body.Close()
+		if done {
+			return result, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if lastEventID == "" || attempt >= maxResumeAttempts {
+			if err != nil {
+				return nil, fmt.Errorf("response stream closed before response: %w", err)
+			}
+			return nil, fmt.Errorf("response stream closed before response")
+		}
+
+		body, err = c.resume(ctx, lastEventID)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readEvents 读取一个 SSE 流直到收到 id 对应的响应（done 为 true）或流结束
+func (c *RemoteToolClient) readEvents(body io.Reader, id json.RawMessage, lastEventID *string) (json.RawMessage, bool, error) {
+	reader := sse.NewReader(body)
+	for {
+		ev, err := reader.Next()
+		if err == io.EOF {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if ev.ID != "" {
+			*lastEventID = ev.ID
+		}
+		if ev.Event != "message" || ev.Data == "" {
+			continue
+		}
+
+		var msg protocol.JSONRPCMessage
+		if err := json.Unmarshal([]byte(ev.Data), &msg); err != nil {
+			continue // 忽略无法解析的事件
+		}
+		switch {
+		case msg.IsResponse() && string(msg.ID) == string(id):
+			result, err := resultOf(&msg)
+			return result, true, err
+		case msg.IsRequest():
+			go c.replyToServer(&msg)
+		}
+		// 通知（日志、进度等）目前忽略
+	}
+}
+
+// resume 通过 GET 请求与 Last-Event-ID 续传中断的 SSE 流
+func (c *RemoteToolClient) resume(ctx context.Context, lastEventID string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(req)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(HeaderLastEventID, lastEventID)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resume response stream: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to resume response stream: %w", newStatusError(resp))
+	}
+	return resp.Body, nil
+}
+
+// Notify 发送 JSON-RPC 通知，不等待响应
+func (c *RemoteToolClient) Notify(ctx context.Context, method string, params interface{}) error {
+	return c.send(ctx, protocol.NewNotification(method, params))
+}
+
+// replyToServer 响应服务器通过 SSE 流发来的请求
+func (c *RemoteToolClient) replyToServer(msg *protocol.JSONRPCMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	_ = c.send(ctx, mcp.ServerRequestResponse(msg))
+}
+
+// send POST 一条不需要响应的消息（通知或对服务器请求的响应），服务器应返回 202 Accepted
+func (c *RemoteToolClient) send(ctx context.Context, msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	resp, err := c.post(ctx, body)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+// canceled 在 ctx 被取消时通知服务器放弃请求并返回 ctx.Err()，否则原样返回 err
+// 规范要求 initialize 请求不能被取消
+func (c *RemoteToolClient) canceled(ctx context.Context, id json.RawMessage, method string, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	if method != protocol.MethodInitialize {
+		go func() {
+			nctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			_ = c.Notify(nctx, protocol.MethodCancelled, protocol.CancelledParams{
+				RequestID: id,
+				Reason:    ctx.Err().Error(),
+			})
+		}()
+	}
+	return ctx.Err()
+}
+
+// post 将一条 JSON-RPC 消息 POST 到端点，返回状态码为 200 或 202 的响应
+// 响应中带有会话 ID 时记录下来，之后的请求都会携带
+func (c *RemoteToolClient) post(ctx context.Context, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if sessionID := resp.Header.Get(HeaderSessionID); sessionID != "" {
+		c.mu.Lock()
+		if c.sessionID == "" {
+			c.sessionID = sessionID
+		}
+		c.mu.Unlock()
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusAccepted:
+		return resp, nil
+	case resp.StatusCode == http.StatusNotFound && req.Header.Get(HeaderSessionID) != "":
+		resp.Body.Close()
+		return nil, errSessionExpired
+	default:
+		return nil, newStatusError(resp)
+	}
+}
+
+// setHeaders 设置自定义请求头、会话 ID 与协议版本
+func (c *RemoteToolClient) setHeaders(req *http.Request) {
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessionID != "" {
+		req.Header.Set(HeaderSessionID, c.sessionID)
+	}
+	if c.protocolVersion != "" {
+		req.Header.Set(HeaderProtocolVersion, c.protocolVersion)
+	}
+}
+
+// resultOf 返回响应中的 result，JSON-RPC 错误以 *protocol.JSONRPCError 返回
+func resultOf(msg *protocol.JSONRPCMessage) (json.RawMessage, error) {
+	if msg.Error != nil {
+		return nil, msg.Error
+	}
+	return msg.Result, nil
+}
+
+// Call 调用指定名称的工具，并传入参数
+func (c *RemoteToolClient) Call(ctx context.Context, name string, args tools.ToolArguments) (string, error) {
+	return mcp.CallTool(ctx, c, name, args)
+}
+
+// List 获取服务器支持的所有工具定义
+func (c *RemoteToolClient) List(ctx context.Context) ([]tools.ToolDefinition, error) {
+	return mcp.ListTools(ctx, c)
+}
+
+// Close 通知服务器结束会话（DELETE 请求）；服务器不支持时忽略
+func (c *RemoteToolClient) Close() error {
+	if c.session() == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.url, nil)
+	if err != nil {
+		return nil
+	}
+	c.setHeaders(req)
+	if resp, err := c.httpClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// fakeStreamable 是测试用的 Streamable HTTP MCP 服务器：initialize 创建会话，其余请求必须携带有效的会话 ID
+type fakeStreamable struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	sessions map[string]bool
+	inits    int
+	received []protocol.JSONRPCMessage // 收到的全部消息（请求、通知与响应）
+
+	// reply 写出 initialize 以外请求的响应，为 nil 时以 application/json 返回 fakeResult
+	reply func(w http.ResponseWriter, msg protocol.JSONRPCMessage)
+	// stale 在请求携带的会话已失效、即将返回 404 前调用
+	stale func()
+	// resume 处理续传 SSE 流的 GET 请求
+	resume http.HandlerFunc
+}
+
+func newFakeStreamable(t *testing.T) (*fakeStreamable, *httptest.Server) {
+	f := &fakeStreamable{t: t, sessions: make(map[string]bool)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeStreamable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if f.resume == nil {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		f.resume(w, r)
+		return
+	case http.MethodDelete:
+		f.mu.Lock()
+		delete(f.sessions, r.Header.Get(HeaderSessionID))
+		f.mu.Unlock()
+		return
+	}
+
+	var msg protocol.JSONRPCMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.received = append(f.received, msg)
+	f.mu.Unlock()
+
+	if msg.Method == protocol.MethodInitialize {
+		f.mu.Lock()
+		f.inits++
+		session := fmt.Sprintf("session-%d", f.inits)
+		f.sessions[session] = true
+		f.mu.Unlock()
+		w.Header().Set(HeaderSessionID, session)
+		writeResult(w, msg.ID, initializeResult())
+		return
+	}
+
+	f.mu.Lock()
+	valid := f.sessions[r.Header.Get(HeaderSessionID)]
+	f.mu.Unlock()
+	if !valid {
+		if f.stale != nil {
+			f.stale()
+		}
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	if r.Header.Get(HeaderProtocolVersion) != protocol.LatestProtocolVersion {
+		f.t.Errorf("%s sent with protocol version %q", msg.Method, r.Header.Get(HeaderProtocolVersion))
+	}
+
+	if !msg.IsRequest() {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if f.reply != nil {
+		f.reply(w, msg)
+		return
+	}
+	writeResult(w, msg.ID, fakeResult(msg))
+}
+
+// expireSessions 让服务器忘记全部会话，之后的请求收到 404
+func (f *fakeStreamable) expireSessions() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions = make(map[string]bool)
+}
+
+func (f *fakeStreamable) initCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.inits
+}
+
+func initializeResult() protocol.InitializeResult {
+	return protocol.InitializeResult{
+		ProtocolVersion: protocol.LatestProtocolVersion,
+		ServerInfo:      protocol.Implementation{Name: "fake", Version: "1.0"},
+	}
+}
+
+// fakeResult 返回 tools/list 与 tools/call 的结果：只有一个 echo 工具，原样返回参数 text
+func fakeResult(msg protocol.JSONRPCMessage) interface{} {
+	switch msg.Method {
+	case protocol.MethodToolsList:
+		return protocol.ListToolsResult{Tools: []protocol.Tool{{
+			Name:        "echo",
+			InputSchema: tools.Schema{Type: tools.SchemaType{"object"}},
+		}}}
+	case protocol.MethodToolsCall:
+		var params protocol.CallToolParams
+		_ = json.Unmarshal(msg.Params, &params)
+		return protocol.CallToolResult{Content: []protocol.Content{protocol.TextContent(fmt.Sprint(params.Arguments["text"]))}}
+	default:
+		return struct{}{}
+	}
+}
+
+func writeResult(w http.ResponseWriter, id json.RawMessage, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(protocol.NewResult(id, result))
+}
+
+// writeEvent 写出一个 SSE 事件并立即发送
+func writeEvent(w http.ResponseWriter, id, event string, data interface{}) {
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	b, _ := json.Marshal(data)
+	fmt.Fprintf(w, "data: %s\n\n", b)
+	w.(http.Flusher).Flush()
+}
+
+func newTestRemoteClient(t *testing.T, url string) *RemoteToolClient {
+	t.Helper()
+	c, err := NewRemoteToolClient(Options{URL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRemoteJSONResponse(t *testing.T) {
+	_, srv := newFakeStreamable(t)
+	c := newTestRemoteClient(t, srv.URL)
+
+	if got := c.ServerInfo().ServerInfo.Name; got != "fake" {
+		t.Fatalf("server name = %q", got)
+	}
+	defs, err := c.List(context.Background())
+	if err != nil || len(defs) != 1 || defs[0].Name != "echo" {
+		t.Fatalf("got %+v, %v", defs, err)
+	}
+	got, err := c.Call(context.Background(), "echo", tools.ToolArguments{"text": "hi"})
+	if err != nil || got != "hi" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
+
+func TestRemoteSSEResponse(t *testing.T) {
+	f, srv := newFakeStreamable(t)
+	f.reply = func(w http.ResponseWriter, msg protocol.JSONRPCMessage) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// 响应之前先到达的无关事件：进度通知、其他类型的事件、服务器请求与其他 ID 的响应
+		writeEvent(w, "1", "", protocol.NewNotification("notifications/progress", map[string]int{"progress": 1}))
+		writeEvent(w, "2", "heartbeat", map[string]string{})
+		writeEvent(w, "3", "", protocol.NewRequest(json.RawMessage(`"srv-1"`), protocol.MethodPing, nil))
+		writeEvent(w, "4", "", protocol.NewResult(json.RawMessage(`999`), "not ours"))
+		fmt.Fprint(w, ": keep-alive\n\n")
+		writeEvent(w, "5", "", protocol.NewResult(msg.ID, fakeResult(msg)))
+	}
+	c := newTestRemoteClient(t, srv.URL)
+
+	got, err := c.Call(context.Background(), "echo", tools.ToolArguments{"text": "streamed"})
+	if err != nil || got != "streamed" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	// 客户端异步回复服务器的 ping
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.mu.Lock()
+		replied := false
+		for _, msg := range f.received {
+			if msg.IsResponse() && string(msg.ID) == `"srv-1"` {
+				replied = true
+			}
+		}
+		f.mu.Unlock()
+		if replied {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("client did not answer the server's ping")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRemoteSessionExpiredReinitializes(t *testing.T) {
+	f, srv := newFakeStreamable(t)
+	c := newTestRemoteClient(t, srv.URL)
+
+	f.expireSessions()
+	got, err := c.Call(context.Background(), "echo", tools.ToolArguments{"text": "again"})
+	if err != nil || got != "again" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if n := f.initCount(); n != 2 {
+		t.Fatalf("got %d initialize requests, want 2", n)
+	}
+	if c.session() != "session-2" {
+		t.Fatalf("session = %q, want the new session", c.session())
+	}
+}
+
+func TestRemoteConcurrentSessionExpiry(t *testing.T) {
+	f, srv := newFakeStreamable(t)
+	c := newTestRemoteClient(t, srv.URL)
+
+	// 两个请求都带着旧会话到达后才一起返回 404
+	var stale int32
+	both := make(chan struct{})
+	f.stale = func() {
+		if atomic.AddInt32(&stale, 1) == 2 {
+			close(both)
+		}
+		select {
+		case <-both:
+		case <-time.After(5 * time.Second):
+		}
+	}
+	f.expireSessions()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			text := fmt.Sprint("call ", i)
+			got, err := c.Call(context.Background(), "echo", tools.ToolArguments{"text": text})
+			if err != nil {
+				errs <- fmt.Errorf("call %d: %w", i, err)
+			} else if got != text {
+				errs <- fmt.Errorf("call %d got %q", i, got)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if atomic.LoadInt32(&stale) < 2 {
+		t.Fatal("requests did not both hit the expired session")
+	}
+	if n := f.initCount(); n != 2 {
+		t.Fatalf("got %d initialize requests, want exactly one re-initialization", n)
+	}
+}
+
+func TestRemoteResumesDroppedStream(t *testing.T) {
+	f, srv := newFakeStreamable(t)
+	var pending atomic.Value // 等待续传的请求
+	f.reply = func(w http.ResponseWriter, msg protocol.JSONRPCMessage) {
+		pending.Store(msg)
+		w.Header().Set("Content-Type", "text/event-stream")
+		writeEvent(w, "evt-7", "", protocol.NewNotification("notifications/progress", map[string]int{"progress": 1}))
+		// 响应到达前断开
+	}
+	var lastEventID string
+	f.resume = func(w http.ResponseWriter, r *http.Request) {
+		lastEventID = r.Header.Get(HeaderLastEventID)
+		msg := pending.Load().(protocol.JSONRPCMessage)
+		w.Header().Set("Content-Type", "text/event-stream")
+		writeEvent(w, "evt-8", "", protocol.NewResult(msg.ID, fakeResult(msg)))
+	}
+	c := newTestRemoteClient(t, srv.URL)
+
+	got, err := c.Call(context.Background(), "echo", tools.ToolArguments{"text": "resumed"})
+	if err != nil || got != "resumed" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if lastEventID != "evt-7" {
+		t.Fatalf("resumed with Last-Event-ID %q, want evt-7", lastEventID)
+	}
+}
+
+func TestRemoteStreamClosedWithoutEventID(t *testing.T) {
+	f, srv := newFakeStreamable(t)
+	f.reply = func(w http.ResponseWriter, msg protocol.JSONRPCMessage) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, ": nothing to resume from\n\n")
+	}
+	c := newTestRemoteClient(t, srv.URL)
+
+	_, err := c.Call(context.Background(), "echo", tools.ToolArguments{"text": "lost"})
+	if err == nil || !strings.Contains(err.Error(), "closed before response") {
+		t.Fatalf("got %v, want a closed stream error", err)
+	}
+}
@@ -0,0 +1,437 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/sse"
+	"github.com/windlant/mcp-client/internal/tools"
+	"github.com/windlant/mcp-client/internal/tools/mcp"
+)
+
+// 断线重连的等待时间，每次失败后翻倍
+const (
+	reconnectInitialBackoff = time.Second
+	reconnectMaxBackoff     = 30 * time.Second
+)
+
+// errClientClosed 表示客户端已经关闭
+var errClientClosed = errors.New("MCP client closed")
+
+// sseConn 是一次 SSE 连接：GET 得到的事件流，以及服务器通过 endpoint 事件告知的 POST 地址
+type sseConn struct {
+	endpoint string
+	cancel   context.CancelFunc // 断开事件流
+	done     chan struct{}      // 事件流结束后关闭
+}
+
+// SSEToolClient 通过旧版 MCP HTTP+SSE 传输（协议版本 2024-11-05）与远程工具服务器通信：
+// 客户端 GET 一个长期保持的 SSE 流，服务器先发送 endpoint 事件告知 POST 地址，
+// 之后客户端的请求 POST 到该地址，响应通过 SSE 流返回。事件流断开后会自动重连并重新握手
+type SSEToolClient struct {
+	url        string
+	headers    map[string]string
+	httpClient *http.Client
+	nextID     int64 // 最近一次分配的请求 ID，原子递增
+
+	pendingMu sync.Mutex
+	pending   map[string]chan *protocol.JSONRPCMessage // 按请求 ID 等待响应的调用方
+
+	mu     sync.Mutex
+	conn   *sseConn      // 当前可用的连接，重连期间为 nil
+	ready  chan struct{} // conn 可用时关闭，重连开始时替换为新的通道
+	server protocol.InitializeResult
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewSSEToolClient 连接一个使用旧版 HTTP+SSE 传输的 MCP 服务器并完成 initialize 握手
+// opts.URL 是 SSE 流的地址，通常以 /sse 结尾
+func NewSSEToolClient(opts Options) (*SSEToolClient, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("server url is required")
+	}
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	client := &SSEToolClient{
+		url:        opts.URL,
+		headers:    opts.Headers,
+		httpClient: httpClient,
+		pending:    make(map[string]chan *protocol.JSONRPCMessage),
+		ready:      make(chan struct{}),
+		closed:     make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), initializeTimeout)
+	defer cancel()
+	conn, err := client.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client.setConn(conn)
+	go client.maintain(conn)
+
+	return client, nil
+}
+
+// ServerInfo 返回握手时服务器上报的协议版本、能力与实现信息
+func (c *SSEToolClient) ServerInfo() protocol.InitializeResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.server
+}
+
+// dial 建立一次 SSE 连接：GET 事件流、等待 endpoint 事件，并在新连接上完成握手
+func (c *SSEToolClient) dial(ctx context.Context) (*sseConn, error) {
+	// 事件流的生命周期独立于 ctx，ctx 只限制建立连接与握手的时间
+	streamCtx, cancelStream := context.WithCancel(context.Background())
+	stop := context.AfterFunc(ctx, cancelStream)
+	defer stop()
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, c.url, nil)
+	if err != nil {
+		cancelStream()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		cancelStream()
+		return nil, fmt.Errorf("failed to open SSE stream: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		cancelStream()
+		return nil, fmt.Errorf("failed to open SSE stream: %w", newStatusError(resp))
+	}
+
+	reader := sse.NewReader(resp.Body)
+	endpoint, err := c.readEndpoint(reader)
+	if err != nil {
+		cancelStream()
+		resp.Body.Close()
+		return nil, err
+	}
+
+	conn := &sseConn{
+		endpoint: endpoint,
+		cancel:   cancelStream,
+		done:     make(chan struct{}),
+	}
+	go c.readLoop(conn, reader, resp.Body)
+
+	server, err := mcp.Initialize(ctx, &connTransport{client: c, conn: conn})
+	if err != nil {
+		cancelStream()
+		return nil, err
+	}
+	c.mu.Lock()
+	c.server = server
+	c.mu.Unlock()
+
+	return conn, nil
+}
+
+// readEndpoint 读取服务器发送的 endpoint 事件，并将其中的地址解析为绝对地址
+func (c *SSEToolClient) readEndpoint(reader *sse.Reader) (string, error) {
+	for {
+		ev, err := reader.Next()
+		if err != nil {
+			return "", fmt.Errorf("SSE stream closed before endpoint event: %w", err)
+		}
+		if ev.Event != "endpoint" {
+			continue
+		}
+
+		base, err := url.Parse(c.url)
+		if err != nil {
+			return "", fmt.Errorf("invalid server url: %w", err)
+		}
+		ref, err := url.Parse(ev.Data)
+		if err != nil {
+			return "", fmt.Errorf("invalid endpoint %q: %w", ev.Data, err)
+		}
+		return base.ResolveReference(ref).String(), nil
+	}
+}
+
+// readLoop 读取事件流中的消息并分发给等待的调用方，事件流结束后关闭 conn.done
+func (c *SSEToolClient) readLoop(conn *sseConn, reader *sse.Reader, body io.Closer) {
+	defer close(conn.done)
+	defer body.Close()
+
+	for {
+		ev, err := reader.Next()
+		if err != nil {
+			return
+		}
+		if ev.Event != "message" || ev.Data == "" {
+			continue
+		}
+
+		var msg protocol.JSONRPCMessage
+		if err := json.Unmarshal([]byte(ev.Data), &msg); err != nil {
+			continue // 忽略无法解析的事件
+		}
+		switch {
+		case msg.IsResponse():
+			c.dispatch(&msg)
+		case msg.IsRequest():
+			go c.replyToServer(conn, &msg)
+		}
+		// 通知（日志、进度等）目前忽略
+	}
+}
+
+// maintain 在事件流断开后按指数退避重连，直到客户端关闭
+// 重连期间发起的请求会等待新连接就绪；断开时尚未收到响应的请求返回错误
+func (c *SSEToolClient) maintain(conn *sseConn) {
+	for {
+		select {
+		case <-conn.done:
+		case <-c.closed:
+			return
+		}
+		c.detach(conn)
+
+		backoff := reconnectInitialBackoff
+		for {
+			select {
+			case <-time.After(backoff):
+			case <-c.closed:
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), initializeTimeout)
+			next, err := c.dial(ctx)
+			cancel()
+			if err == nil {
+				conn = next
+				break
+			}
+
+			backoff *= 2
+			if backoff > reconnectMaxBackoff {
+				backoff = reconnectMaxBackoff
+			}
+		}
+
+		// Close 可能在重连期间被调用，此时新连接不再需要
+		select {
+		case <-c.closed:
+			conn.cancel()
+			return
+		default:
+			c.setConn(conn)
+		}
+	}
+}
+
+// setConn 设置新的可用连接
+func (c *SSEToolClient) setConn(conn *sseConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn = conn
+	close(c.ready)
+}
+
+// detach 在 conn 的事件流断开后将其移除，之后的请求等待重连完成
+func (c *SSEToolClient) detach(conn *sseConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == conn {
+		c.conn = nil
+		c.ready = make(chan struct{})
+	}
+}
+
+// currentConn 返回当前连接，重连期间等待新连接就绪
+func (c *SSEToolClient) currentConn(ctx context.Context) (*sseConn, error) {
+	for {
+		c.mu.Lock()
+		conn, ready := c.conn, c.ready
+		c.mu.Unlock()
+		if conn != nil {
+			select {
+			case <-conn.done:
+				// 事件流刚刚断开而 maintain 尚未处理，等待重连
+				c.detach(conn)
+			default:
+				return conn, nil
+			}
+		}
+
+		select {
+		case <-ready:
+		case <-c.closed:
+			return nil, errClientClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// dispatch 将响应交给等待该 ID 的调用方；没有调用方等待（请求已被取消）时丢弃
+func (c *SSEToolClient) dispatch(msg *protocol.JSONRPCMessage) {
+	c.pendingMu.Lock()
+	ch, ok := c.pending[string(msg.ID)]
+	delete(c.pending, string(msg.ID))
+	c.pendingMu.Unlock()
+
+	if ok {
+		ch <- msg // 通道有 1 个缓冲，不会阻塞
+	}
+}
+
+// Request 在当前连接上发送 JSON-RPC 请求并等待响应
+func (c *SSEToolClient) Request(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	conn, err := c.currentConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.request(ctx, conn, method, params)
+}
+
+// Notify 在当前连接上发送 JSON-RPC 通知
+func (c *SSEToolClient) Notify(ctx context.Context, method string, params interface{}) error {
+	conn, err := c.currentConn(ctx)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, conn, protocol.NewNotification(method, params))
+}
+
+// request 将请求 POST 到 conn 的 endpoint，并等待响应从事件流返回
+// ctx 被取消时向服务器发送 notifications/cancelled；事件流在响应到达前断开时返回错误
+func (c *SSEToolClient) request(ctx context.Context, conn *sseConn, method string, params interface{}) (json.RawMessage, error) {
+	id := protocol.IntID(atomic.AddInt64(&c.nextID, 1))
+	ch := make(chan *protocol.JSONRPCMessage, 1)
+
+	c.pendingMu.Lock()
+	c.pending[string(id)] = ch
+	c.pendingMu.Unlock()
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, string(id))
+		c.pendingMu.Unlock()
+	}()
+
+	if err := c.send(ctx, conn, protocol.NewRequest(id, method, params)); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	select {
+	case msg := <-ch:
+		return resultOf(msg)
+	case <-conn.done:
+		return nil, fmt.Errorf("SSE stream disconnected before response to %s", method)
+	case <-ctx.Done():
+		// 规范要求 initialize 请求不能被取消
+		if method != protocol.MethodInitialize {
+			go func() {
+				nctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+				defer cancel()
+				_ = c.send(nctx, conn, protocol.NewNotification(protocol.MethodCancelled, protocol.CancelledParams{
+					RequestID: id,
+					Reason:    ctx.Err().Error(),
+				}))
+			}()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// send 将一条消息 POST 到 conn 的 endpoint，服务器应返回 202 Accepted（部分实现返回 200）
+func (c *SSEToolClient) send(ctx context.Context, conn *sseConn, msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, conn.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newStatusError(resp)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+// replyToServer 响应服务器通过事件流发来的请求
+func (c *SSEToolClient) replyToServer(conn *sseConn, msg *protocol.JSONRPCMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	_ = c.send(ctx, conn, mcp.ServerRequestResponse(msg))
+}
+
+// Call 调用指定名称的工具，并传入参数
+func (c *SSEToolClient) Call(ctx context.Context, name string, args tools.ToolArguments) (string, error) {
+	return mcp.CallTool(ctx, c, name, args)
+}
+
+// List 获取服务器支持的所有工具定义
+func (c *SSEToolClient) List(ctx context.Context) ([]tools.ToolDefinition, error) {
+	return mcp.ListTools(ctx, c)
+}
+
+// Close 断开事件流并停止重连
+func (c *SSEToolClient) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+		if conn != nil {
+			conn.cancel()
+		}
+	})
+	return nil
+}
+
+// connTransport 将请求固定发送到某一个连接，用于在新连接就绪前完成握手
+type connTransport struct {
+	client *SSEToolClient
+	conn   *sseConn
+}
+
+// Request 实现 mcp.Transport
+func (t *connTransport) Request(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	return t.client.request(ctx, t.conn, method, params)
+}
+
+// Notify 实现 mcp.Transport
+func (t *connTransport) Notify(ctx context.Context, method string, params interface{}) error {
+	return t.client.send(ctx, t.conn, protocol.NewNotification(method, params))
+}
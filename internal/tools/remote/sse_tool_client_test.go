@@ -0,0 +1,340 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// fakeLegacy 是测试用的旧版 HTTP+SSE MCP 服务器：GET /sse 建立事件流并发送 endpoint 事件，
+// 客户端把消息 POST 到 endpoint，服务器返回 202 后通过该事件流发送响应
+type fakeLegacy struct {
+	t *testing.T
+
+	// endpoint 返回第 conn 个事件流在 endpoint 事件中告知的地址，为 nil 时使用 "/messages?conn=<conn>"
+	endpoint func(base string, conn int) string
+	// postStatus 是 POST 到 /sse 时返回的状态码，用于检测传输方式，为 0 时返回 405
+	postStatus int
+	// hold 返回 true 的请求不发送响应
+	hold func(msg protocol.JSONRPCMessage) bool
+
+	srv *httptest.Server
+
+	mu      sync.Mutex
+	conns   int
+	inits   int
+	streams map[int]*legacyStream
+	posts   []string // 收到的 POST 请求地址（路径与查询参数）
+}
+
+// legacyStream 是一个已建立的事件流
+type legacyStream struct {
+	out  chan interface{}
+	drop chan struct{}
+}
+
+func newFakeLegacy(t *testing.T) *fakeLegacy {
+	f := &fakeLegacy{t: t, streams: make(map[int]*legacyStream)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", f.handleSSE)
+	mux.HandleFunc("/messages", f.handleMessage)
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeLegacy) handleSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		status := f.postStatus
+		if status == 0 {
+			status = http.StatusMethodNotAllowed
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	f.mu.Lock()
+	f.conns++
+	conn := f.conns
+	stream := &legacyStream{out: make(chan interface{}, 16), drop: make(chan struct{})}
+	f.streams[conn] = stream
+	f.mu.Unlock()
+
+	endpoint := fmt.Sprintf("/messages?conn=%d", conn)
+	if f.endpoint != nil {
+		endpoint = f.endpoint(f.srv.URL, conn)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	// endpoint 之前的无关事件应被忽略
+	fmt.Fprint(w, ": welcome\n\nevent: heartbeat\ndata: {}\n\n")
+	fmt.Fprintf(w, "event: endpoint\ndata: %s\n\n", endpoint)
+	w.(http.Flusher).Flush()
+
+	for {
+		select {
+		case msg := <-stream.out:
+			writeEvent(w, "", "message", msg)
+		case <-stream.drop:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (f *fakeLegacy) handleMessage(w http.ResponseWriter, r *http.Request) {
+	conn, _ := strconv.Atoi(r.URL.Query().Get("conn"))
+	f.mu.Lock()
+	stream, ok := f.streams[conn]
+	f.posts = append(f.posts, r.URL.RequestURI())
+	f.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown connection", http.StatusNotFound)
+		return
+	}
+
+	var msg protocol.JSONRPCMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	// 先完成 202 响应，结果随后才出现在事件流上
+	w.WriteHeader(http.StatusAccepted)
+	w.(http.Flusher).Flush()
+
+	if !msg.IsRequest() || (f.hold != nil && f.hold(msg)) {
+		return
+	}
+	var result interface{}
+	if msg.Method == protocol.MethodInitialize {
+		f.mu.Lock()
+		f.inits++
+		f.mu.Unlock()
+		result = protocol.InitializeResult{
+			ProtocolVersion: "2024-11-05",
+			ServerInfo:      protocol.Implementation{Name: "legacy", Version: "1.0"},
+		}
+	} else {
+		result = fakeResult(msg)
+	}
+	// 响应之前先发送无关的通知与其他 ID 的响应
+	stream.out <- protocol.NewNotification("notifications/message", map[string]string{"level": "info"})
+	stream.out <- protocol.NewResult(json.RawMessage(`999`), "not ours")
+	stream.out <- protocol.NewResult(msg.ID, result)
+}
+
+// dropStreams 断开所有已建立的事件流
+func (f *fakeLegacy) dropStreams() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn, stream := range f.streams {
+		close(stream.drop)
+		delete(f.streams, conn)
+	}
+}
+
+func (f *fakeLegacy) counts() (conns, inits int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns, f.inits
+}
+
+func (f *fakeLegacy) postedTo() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.posts...)
+}
+
+func newTestSSEClient(t *testing.T, url string) *SSEToolClient {
+	t.Helper()
+	c, err := NewSSEToolClient(Options{URL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// callEcho 通过 echo 工具往返一次，确认请求与响应都能送达
+func callEcho(t *testing.T, c tools.ToolClient, text string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	got, err := c.Call(ctx, "echo", tools.ToolArguments{"text": text})
+	if err != nil || got != text {
+		t.Fatalf("echo returned %q, %v; want %q", got, err, text)
+	}
+}
+
+func TestSSEEndpointDiscovery(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint func(base string, conn int) string
+	}{
+		{"absolute path", func(base string, conn int) string { return fmt.Sprintf("/messages?conn=%d", conn) }},
+		{"relative to the stream url", func(base string, conn int) string { return fmt.Sprintf("messages?conn=%d", conn) }},
+		{"absolute url", func(base string, conn int) string { return fmt.Sprintf("%s/messages?conn=%d", base, conn) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeLegacy(t)
+			f.endpoint = tt.endpoint
+			c := newTestSSEClient(t, f.srv.URL+"/sse")
+
+			if got := c.ServerInfo().ServerInfo.Name; got != "legacy" {
+				t.Errorf("server name = %q, want legacy", got)
+			}
+			callEcho(t, c, "hi")
+
+			for _, uri := range f.postedTo() {
+				if uri != "/messages?conn=1" {
+					t.Errorf("message posted to %q, want /messages?conn=1", uri)
+				}
+			}
+		})
+	}
+}
+
+func TestSSEStreamClosedBeforeEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: heartbeat\ndata: {}\n\n")
+	}))
+	defer srv.Close()
+
+	_, err := NewSSEToolClient(Options{URL: srv.URL})
+	if err == nil || !strings.Contains(err.Error(), "before endpoint event") {
+		t.Fatalf("error = %v, want stream closed before endpoint event", err)
+	}
+}
+
+func TestSSEResponsesArriveOnStream(t *testing.T) {
+	f := newFakeLegacy(t)
+	c := newTestSSEClient(t, f.srv.URL+"/sse")
+
+	// 并发的请求各自等到自己的响应
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			callEcho(t, c, fmt.Sprintf("call-%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	defs, err := c.List(context.Background())
+	if err != nil || len(defs) != 1 || defs[0].Name != "echo" {
+		t.Fatalf("tools = %+v, %v", defs, err)
+	}
+}
+
+func TestSSEReconnectsAfterStreamDrops(t *testing.T) {
+	f := newFakeLegacy(t)
+	f.hold = func(msg protocol.JSONRPCMessage) bool {
+		var params protocol.CallToolParams
+		_ = json.Unmarshal(msg.Params, &params)
+		return params.Arguments["text"] == "never answered"
+	}
+	c := newTestSSEClient(t, f.srv.URL+"/sse")
+	callEcho(t, c, "before")
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.Call(context.Background(), "echo", tools.ToolArguments{"text": "never answered"})
+		errCh <- err
+	}()
+	// 等待请求送达后再断开事件流
+	for deadline := time.Now().Add(5 * time.Second); len(f.postedTo()) < 4; {
+		if time.Now().After(deadline) {
+			t.Fatal("request was not posted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	f.dropStreams()
+
+	select {
+	case err := <-errCh:
+		if err == nil || !strings.Contains(err.Error(), "disconnected") {
+			t.Errorf("pending call error = %v, want stream disconnected", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pending call did not fail when the stream dropped")
+	}
+
+	// 重连期间发起的调用等待新连接完成握手
+	callEcho(t, c, "after")
+	if conns, inits := f.counts(); conns != 2 || inits != 2 {
+		t.Errorf("conns = %d, inits = %d; want a second stream with its own handshake", conns, inits)
+	}
+	posts := f.postedTo()
+	if last := posts[len(posts)-1]; last != "/messages?conn=2" {
+		t.Errorf("call after reconnect posted to %q, want the new endpoint", last)
+	}
+}
+
+func TestNewToolClientDetectsTransport(t *testing.T) {
+	tests := []struct {
+		status   int
+		fallback bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusNotFound, true},
+		{http.StatusMethodNotAllowed, true},
+		{http.StatusUnauthorized, false},
+		{http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			f := newFakeLegacy(t)
+			f.postStatus = tt.status
+
+			c, err := NewToolClient(Options{URL: f.srv.URL + "/sse"})
+			if !tt.fallback {
+				if err == nil {
+					c.Close()
+					t.Fatal("NewToolClient succeeded, want the Streamable HTTP error")
+				}
+				if !strings.Contains(err.Error(), strconv.Itoa(tt.status)) {
+					t.Errorf("error %q does not mention status %d", err, tt.status)
+				}
+				if conns, _ := f.counts(); conns != 0 {
+					t.Errorf("opened %d SSE streams, want no fallback", conns)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("NewToolClient failed: %v", err)
+			}
+			defer c.Close()
+			if _, ok := c.(*SSEToolClient); !ok {
+				t.Fatalf("client is %T, want *SSEToolClient", c)
+			}
+			callEcho(t, c, "detected")
+		})
+	}
+}
+
+func TestNewToolClientPrefersStreamableHTTP(t *testing.T) {
+	_, srv := newFakeStreamable(t)
+	c, err := NewToolClient(Options{URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, ok := c.(*RemoteToolClient); !ok {
+		t.Fatalf("client is %T, want *RemoteToolClient", c)
+	}
+}
@@ -0,0 +1,231 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Schema 是描述工具参数的 JSON Schema
+// 常用关键字解析到对应字段，其余关键字（$ref、$defs、patternProperties、if/then/else 等）以及形式与字段不符的值
+// （例如数组形式的 items）原样保存在 Extra 中，因此从 MCP 服务器获取的 schema 可以不丢失信息地转发给模型
+// 切片与 map 字段以是否为 nil 区分“未设置”与“设置为空”，序列化时保留空的 properties 与 required
+type Schema struct {
+	// Bool 非 nil 时表示布尔形式的 schema：true 接受任意值，false 不接受任何值，此时忽略其他字段
+	Bool *bool
+
+	Type        SchemaType
+	Title       string
+	Description string
+	Format      string          // 例如 "date-time"、"uri"、"email"
+	Enum        []interface{}   // 允许的取值
+	Const       json.RawMessage // 唯一允许的取值，原样保存以区分未设置与 null
+	Default     json.RawMessage // 默认值，原样保存以区分未设置与 null
+
+	// 对象
+	Properties           map[string]*Schema
+	Required             []string
+	AdditionalProperties *Schema // 未在 properties 中声明的属性需满足的 schema，常见的是 false
+
+	// 数组
+	Items       *Schema
+	MinItems    *int
+	MaxItems    *int
+	UniqueItems bool
+
+	// 字符串
+	MinLength *int
+	MaxLength *int
+	Pattern   string
+
+	// 数值
+	Minimum    *float64
+	Maximum    *float64
+	MultipleOf *float64
+
+	// 组合
+	AnyOf []*Schema
+	OneOf []*Schema
+	AllOf []*Schema
+	Not   *Schema
+
+	// Extra 保存其余关键字的原始 JSON
+	Extra map[string]json.RawMessage
+}
+
+// SchemaType 是 type 关键字的值：单个类型名，或允许多种类型时的类型名数组（例如 ["string", "null"]）
+type SchemaType []string
+
+// Has 报告 t 是否包含指定的类型名
+func (t SchemaType) Has(name string) bool {
+	for _, n := range t {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON 只有一个类型时输出字符串，否则输出数组
+func (t SchemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON 同时接受字符串与字符串数组
+func (t *SchemaType) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = SchemaType{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings: %w", err)
+	}
+	*t = many
+	return nil
+}
+
+// MarshalJSON 输出 Extra 中的关键字与所有已设置的字段
+func (s Schema) MarshalJSON() ([]byte, error) {
+	if s.Bool != nil {
+		return json.Marshal(*s.Bool)
+	}
+
+	out := make(map[string]interface{}, len(s.Extra)+8)
+	for k, v := range s.Extra {
+		out[k] = v
+	}
+	set := func(key string, value interface{}, ok bool) {
+		if ok {
+			out[key] = value
+		}
+	}
+	set("type", s.Type, s.Type != nil)
+	set("title", s.Title, s.Title != "")
+	set("description", s.Description, s.Description != "")
+	set("format", s.Format, s.Format != "")
+	set("enum", s.Enum, s.Enum != nil)
+	set("const", s.Const, s.Const != nil)
+	set("default", s.Default, s.Default != nil)
+	set("properties", s.Properties, s.Properties != nil)
+	set("required", s.Required, s.Required != nil)
+	set("additionalProperties", s.AdditionalProperties, s.AdditionalProperties != nil)
+	set("items", s.Items, s.Items != nil)
+	set("minItems", s.MinItems, s.MinItems != nil)
+	set("maxItems", s.MaxItems, s.MaxItems != nil)
+	set("uniqueItems", s.UniqueItems, s.UniqueItems)
+	set("minLength", s.MinLength, s.MinLength != nil)
+	set("maxLength", s.MaxLength, s.MaxLength != nil)
+	set("pattern", s.Pattern, s.Pattern != "")
+	set("minimum", s.Minimum, s.Minimum != nil)
+	set("maximum", s.Maximum, s.Maximum != nil)
+	set("multipleOf", s.MultipleOf, s.MultipleOf != nil)
+	set("anyOf", s.AnyOf, s.AnyOf != nil)
+	set("oneOf", s.OneOf, s.OneOf != nil)
+	set("allOf", s.AllOf, s.AllOf != nil)
+	set("not", s.Not, s.Not != nil)
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON 解析对象或布尔形式的 schema
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*s = Schema{Bool: &b}
+		return nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("schema must be an object or a boolean: %w", err)
+	}
+
+	*s = Schema{}
+	for key, value := range raw {
+		if !s.setKeyword(key, value) {
+			if s.Extra == nil {
+				s.Extra = make(map[string]json.RawMessage)
+			}
+			s.Extra[key] = value
+		}
+	}
+	return nil
+}
+
+// setKeyword 将已知关键字解析到对应字段；未知关键字、null 或形式与字段不符的值返回 false，由调用方原样保存
+func (s *Schema) setKeyword(key string, value json.RawMessage) bool {
+	switch key {
+	case "const":
+		s.Const = value
+		return true
+	case "default":
+		s.Default = value
+		return true
+	}
+	if string(value) == "null" {
+		return false
+	}
+
+	switch key {
+	case "type":
+		return decodeKeyword(value, &s.Type)
+	case "title":
+		return decodeKeyword(value, &s.Title)
+	case "description":
+		return decodeKeyword(value, &s.Description)
+	case "format":
+		return decodeKeyword(value, &s.Format)
+	case "enum":
+		return decodeKeyword(value, &s.Enum)
+	case "properties":
+		return decodeKeyword(value, &s.Properties)
+	case "required":
+		return decodeKeyword(value, &s.Required)
+	case "additionalProperties":
+		return decodeKeyword(value, &s.AdditionalProperties)
+	case "items":
+		return decodeKeyword(value, &s.Items)
+	case "minItems":
+		return decodeKeyword(value, &s.MinItems)
+	case "maxItems":
+		return decodeKeyword(value, &s.MaxItems)
+	case "uniqueItems":
+		// false 与未设置等价，保存在 Extra 中以便原样输出
+		return decodeKeyword(value, &s.UniqueItems) && s.UniqueItems
+	case "minLength":
+		return decodeKeyword(value, &s.MinLength)
+	case "maxLength":
+		return decodeKeyword(value, &s.MaxLength)
+	case "pattern":
+		return decodeKeyword(value, &s.Pattern)
+	case "minimum":
+		return decodeKeyword(value, &s.Minimum)
+	case "maximum":
+		return decodeKeyword(value, &s.Maximum)
+	case "multipleOf":
+		return decodeKeyword(value, &s.MultipleOf)
+	case "anyOf":
+		return decodeKeyword(value, &s.AnyOf)
+	case "oneOf":
+		return decodeKeyword(value, &s.OneOf)
+	case "allOf":
+		return decodeKeyword(value, &s.AllOf)
+	case "not":
+		return decodeKeyword(value, &s.Not)
+	default:
+		return false
+	}
+}
+
+// decodeKeyword 将 value 解析到 dst，失败时不修改 dst
+func decodeKeyword[T any](value json.RawMessage, dst *T) bool {
+	var v T
+	if err := json.Unmarshal(value, &v); err != nil {
+		return false
+	}
+	*dst = v
+	return true
+}
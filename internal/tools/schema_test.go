@@ -0,0 +1,247 @@
+package tools
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// schemaFixtures 是常见 MCP 服务器 tools/list 返回的输入 schema
+var schemaFixtures = map[string]string{
+	// @modelcontextprotocol/server-filesystem（zod-to-json-schema 生成，带 $schema 与 additionalProperties: false）
+	"filesystem/edit_file": `{
+		"type": "object",
+		"properties": {
+			"path": {"type": "string"},
+			"edits": {
+				"type": "array",
+				"items": {
+					"type": "object",
+					"properties": {
+						"oldText": {"type": "string", "description": "Text to search for - must match exactly"},
+						"newText": {"type": "string", "description": "Text to replace with"}
+					},
+					"required": ["oldText", "newText"],
+					"additionalProperties": false
+				}
+			},
+			"dryRun": {"type": "boolean", "default": false, "description": "Preview changes using git-style diff format"}
+		},
+		"required": ["path", "edits"],
+		"additionalProperties": false,
+		"$schema": "http://json-schema.org/draft-07/schema#"
+	}`,
+	"filesystem/read_multiple_files": `{
+		"type": "object",
+		"properties": {"paths": {"type": "array", "items": {"type": "string"}}},
+		"required": ["paths"],
+		"additionalProperties": false,
+		"$schema": "http://json-schema.org/draft-07/schema#"
+	}`,
+	// mcp-server-git（pydantic 生成，带 title 与 default）
+	"git/git_log": `{
+		"properties": {
+			"repo_path": {"title": "Repo Path", "type": "string"},
+			"max_count": {"default": 10, "title": "Max Count", "type": "integer"}
+		},
+		"required": ["repo_path"],
+		"title": "GitLog",
+		"type": "object"
+	}`,
+	"git/git_add": `{
+		"properties": {
+			"repo_path": {"title": "Repo Path", "type": "string"},
+			"files": {"items": {"type": "string"}, "title": "Files", "type": "array"}
+		},
+		"required": ["repo_path", "files"],
+		"title": "GitAdd",
+		"type": "object"
+	}`,
+	// mcp-server-sqlite
+	"sqlite/read_query": `{
+		"type": "object",
+		"properties": {"query": {"type": "string", "description": "SELECT SQL query to execute"}},
+		"required": ["query"]
+	}`,
+	"sqlite/list_tables": `{"type": "object", "properties": {}}`,
+	// mcp-server-fetch（draft 2020 的数值形式 exclusiveMinimum/exclusiveMaximum，format: uri）
+	"fetch/fetch": `{
+		"description": "Parameters for fetching a URL.",
+		"properties": {
+			"url": {"description": "URL to fetch", "format": "uri", "minLength": 1, "title": "Url", "type": "string"},
+			"max_length": {"default": 5000, "description": "Maximum number of characters to return.", "exclusiveMaximum": 1000000, "exclusiveMinimum": 0, "title": "Max Length", "type": "integer"},
+			"start_index": {"default": 0, "minimum": 0, "title": "Start Index", "type": "integer"},
+			"raw": {"default": false, "title": "Raw", "type": "boolean"}
+		},
+		"required": ["url"],
+		"title": "Fetch",
+		"type": "object"
+	}`,
+	// pydantic 对 Optional 与嵌套模型生成的 anyOf null、$defs 与 $ref
+	"pydantic/optional_and_refs": `{
+		"$defs": {
+			"Priority": {"enum": ["low", "medium", "high"], "title": "Priority", "type": "string"},
+			"Label": {"properties": {"name": {"type": "string"}, "color": {"anyOf": [{"type": "string"}, {"type": "null"}], "default": null}}, "required": ["name"], "type": "object"}
+		},
+		"properties": {
+			"title": {"type": "string"},
+			"priority": {"$ref": "#/$defs/Priority", "default": "medium"},
+			"labels": {"items": {"$ref": "#/$defs/Label"}, "type": "array"},
+			"due": {"anyOf": [{"format": "date", "type": "string"}, {"type": "null"}], "default": null}
+		},
+		"required": ["title"],
+		"type": "object"
+	}`,
+	// 其余关键字：type 数组、数组形式的 items、const、patternProperties、if/then、uniqueItems: false
+	"misc/keywords": `{
+		"type": "object",
+		"properties": {
+			"nullable": {"type": ["string", "null"], "maxLength": 10},
+			"point": {"type": "array", "items": [{"type": "number"}, {"type": "number"}], "additionalItems": false},
+			"mode": {"const": "fast"},
+			"nothing": {"const": null},
+			"tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": false, "minItems": 0},
+			"meta": {"type": "object", "patternProperties": {"^x-": {"type": "string"}}, "additionalProperties": true},
+			"step": {"type": "number", "multipleOf": 0.5, "minimum": -1.5, "maximum": 1e3},
+			"choice": {"oneOf": [{"type": "integer"}, {"type": "string", "pattern": "^[a-z]+$"}], "not": {"const": 0}},
+			"cond": {"if": {"type": "string"}, "then": {"minLength": 1}, "else": false},
+			"all": {"allOf": [{"type": "string"}, true]}
+		},
+		"required": []
+	}`,
+}
+
+func TestSchemaRoundTrip(t *testing.T) {
+	for name, fixture := range schemaFixtures {
+		t.Run(name, func(t *testing.T) {
+			var s Schema
+			if err := json.Unmarshal([]byte(fixture), &s); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			out, err := json.Marshal(s)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			assertSameJSON(t, fixture, string(out))
+
+			// 再解析一次结果，确保第二轮也不变
+			var again Schema
+			if err := json.Unmarshal(out, &again); err != nil {
+				t.Fatalf("unmarshal round-tripped schema: %v", err)
+			}
+			out2, err := json.Marshal(again)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertSameJSON(t, fixture, string(out2))
+		})
+	}
+}
+
+func TestSchemaKnownKeywordsAreParsed(t *testing.T) {
+	var s Schema
+	if err := json.Unmarshal([]byte(schemaFixtures["filesystem/edit_file"]), &s); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Type.Has("object") || !reflect.DeepEqual(s.Required, []string{"path", "edits"}) {
+		t.Fatalf("type/required not parsed: %+v", s)
+	}
+	if ap := s.AdditionalProperties; ap == nil || ap.Bool == nil || *ap.Bool {
+		t.Fatalf("additionalProperties: false not parsed as a boolean schema: %+v", ap)
+	}
+	edits := s.Properties["edits"]
+	if edits == nil || edits.Items == nil || edits.Items.Properties["oldText"] == nil {
+		t.Fatalf("nested items not parsed: %+v", edits)
+	}
+	if string(s.Properties["dryRun"].Default) != "false" {
+		t.Fatalf("default = %s", s.Properties["dryRun"].Default)
+	}
+	if _, ok := s.Extra["$schema"]; !ok {
+		t.Fatal("$schema not kept in Extra")
+	}
+}
+
+func TestSchemaExtraKeywords(t *testing.T) {
+	var s Schema
+	if err := json.Unmarshal([]byte(schemaFixtures["misc/keywords"]), &s); err != nil {
+		t.Fatal(err)
+	}
+	props := s.Properties
+
+	if got := props["nullable"].Type; !reflect.DeepEqual(got, SchemaType{"string", "null"}) {
+		t.Errorf("type array = %v", got)
+	}
+	// 数组形式的 items 不能解析为单个 schema，应原样保存在 Extra 中
+	if point := props["point"]; point.Items != nil || point.Extra["items"] == nil {
+		t.Errorf("tuple items: Items=%v Extra=%v", point.Items, point.Extra)
+	}
+	if string(props["nothing"].Const) != "null" {
+		t.Errorf("const null = %q", props["nothing"].Const)
+	}
+	if _, ok := props["tags"].Extra["uniqueItems"]; !ok {
+		t.Error("uniqueItems: false should be kept in Extra")
+	}
+	if props["meta"].AdditionalProperties == nil || *props["meta"].AdditionalProperties.Bool != true {
+		t.Error("additionalProperties: true not parsed")
+	}
+	if props["cond"].Extra["else"] == nil {
+		t.Error("else not kept in Extra")
+	}
+
+	var fetch Schema
+	if err := json.Unmarshal([]byte(schemaFixtures["fetch/fetch"]), &fetch); err != nil {
+		t.Fatal(err)
+	}
+	maxLength := fetch.Properties["max_length"]
+	if string(maxLength.Extra["exclusiveMinimum"]) != "0" || string(maxLength.Extra["exclusiveMaximum"]) != "1000000" {
+		t.Errorf("exclusive bounds not kept: %v", maxLength.Extra)
+	}
+
+	var refs Schema
+	if err := json.Unmarshal([]byte(schemaFixtures["pydantic/optional_and_refs"]), &refs); err != nil {
+		t.Fatal(err)
+	}
+	if refs.Extra["$defs"] == nil || refs.Properties["priority"].Extra["$ref"] == nil {
+		t.Error("$defs/$ref not kept in Extra")
+	}
+	if len(refs.Properties["due"].AnyOf) != 2 || string(refs.Properties["due"].Default) != "null" {
+		t.Errorf("anyOf/default null not parsed: %+v", refs.Properties["due"])
+	}
+}
+
+func TestSchemaEmptyValuesArePreserved(t *testing.T) {
+	s := Schema{Type: SchemaType{"object"}, Properties: map[string]*Schema{}, Required: []string{}}
+	out, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameJSON(t, `{"type":"object","properties":{},"required":[]}`, string(out))
+
+	out, err = json.Marshal(Schema{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameJSON(t, `{}`, string(out))
+}
+
+func TestSchemaRejectsInvalidJSON(t *testing.T) {
+	var s Schema
+	if err := json.Unmarshal([]byte(`"object"`), &s); err == nil {
+		t.Fatal("a string is not a schema")
+	}
+}
+
+// assertSameJSON 断言两个 JSON 文本在语义上相同（忽略键顺序与空白）
+func assertSameJSON(t *testing.T, want, got string) {
+	t.Helper()
+	var w, g interface{}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid expected JSON: %v", err)
+	}
+	if err := json.Unmarshal([]byte(got), &g); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if !reflect.DeepEqual(w, g) {
+		t.Fatalf("JSON differs\nwant: %s\ngot:  %s", want, got)
+	}
+}
@@ -0,0 +1,84 @@
+package stdio
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultStderrLines 是未指定 StderrLines 时保留的最近 stderr 行数
+const defaultStderrLines = 20
+
+// stderrDrainTimeout 是进程退出后等待 stderr 读完的最长时间，孙进程可能继续持有管道
+const stderrDrainTimeout = time.Second
+
+// lineRing 保存最近写入的若干行文本，超出容量时丢弃最早的行
+type lineRing struct {
+	mu    sync.Mutex
+	lines []string
+	next  int  // 下一行写入的位置
+	full  bool // 是否已经写满过一轮
+}
+
+// newLineRing 创建一个最多保存 size 行的环形缓冲区
+func newLineRing(size int) *lineRing {
+	if size <= 0 {
+		size = defaultStderrLines
+	}
+	return &lineRing{lines: make([]string, size)}
+}
+
+// add 追加一行
+func (r *lineRing) add(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot 按写入顺序返回当前保存的所有行
+func (r *lineRing) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]string(nil), r.lines[:r.next]...)
+	}
+	out := make([]string, 0, len(r.lines))
+	out = append(out, r.lines[r.next:]...)
+	return append(out, r.lines[:r.next]...)
+}
+
+// captureStderr 逐行读取子进程的 stderr，保存到环形缓冲区并原样转发给 sink（可以为 nil），读完后关闭 sink 与 done
+// 必须持续读取直到管道关闭，否则子进程写满管道缓冲区后会被阻塞
+func captureStderr(r io.Reader, ring *lineRing, sink io.WriteCloser, done chan struct{}) {
+	defer close(done)
+	if sink != nil {
+		defer sink.Close()
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			ring.add(strings.TrimRight(line, "\r\n"))
+			if sink != nil {
+				_, _ = io.WriteString(sink, line)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// sharedSink 包装多个子进程先后共用的转发目标，关闭时不关闭底层的 sink，由 SupervisedClient 在监管结束时关闭
+type sharedSink struct {
+	io.Writer
+}
+
+func (sharedSink) Close() error { return nil }
@@ -0,0 +1,105 @@
+package stdio
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink 记录写入的内容与是否被关闭
+type recordingSink struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closes int
+	closed chan struct{}
+}
+
+func newRecordingSink() *recordingSink {
+	return &recordingSink{closed: make(chan struct{})}
+}
+
+func (s *recordingSink) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(b)
+}
+
+func (s *recordingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closes++
+	if s.closes == 1 {
+		close(s.closed)
+	}
+	return nil
+}
+
+func (s *recordingSink) state() (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String(), s.closes
+}
+
+func TestCaptureStderrClosesSinkAtEOF(t *testing.T) {
+	sink := newRecordingSink()
+	ring := newLineRing(2)
+	done := make(chan struct{})
+	captureStderr(strings.NewReader("one\ntwo\r\nthree"), ring, sink, done)
+
+	<-done
+	if out, closes := sink.state(); out != "one\ntwo\r\nthree" || closes != 1 {
+		t.Fatalf("sink got %q and %d closes", out, closes)
+	}
+	if got := ring.snapshot(); strings.Join(got, ",") != "two,three" {
+		t.Fatalf("ring = %q", got)
+	}
+}
+
+func TestStartFailureClosesSink(t *testing.T) {
+	sink := newRecordingSink()
+	if _, err := NewStdioToolClient(Options{Command: "/nonexistent/mcp-server", Stderr: sink}); err == nil {
+		t.Fatal("started a nonexistent command")
+	}
+	if _, closes := sink.state(); closes != 1 {
+		t.Fatalf("sink closed %d times, want 1", closes)
+	}
+
+	sink = newRecordingSink()
+	if _, err := NewSupervisedClient(Options{Command: "unused", Restart: "sometimes", Stderr: sink}); err == nil {
+		t.Fatal("accepted an unknown restart policy")
+	}
+	if _, closes := sink.state(); closes != 1 {
+		t.Fatalf("sink closed %d times, want 1", closes)
+	}
+}
+
+func TestExitedServerClosesSink(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	// 服务器输出一行 stderr 后不握手直接退出
+	sink := newRecordingSink()
+	_, err = NewSupervisedClient(Options{
+		Command: sh,
+		Args:    []string{"-c", "echo boom >&2; exit 3"},
+		Stderr:  sink,
+	})
+	if err == nil {
+		t.Fatal("started a server that exits without initializing")
+	}
+
+	select {
+	case <-sink.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sink was not closed")
+	}
+	out, closes := sink.state()
+	if out != "boom\n" || closes != 1 {
+		t.Fatalf("sink got %q and %d closes", out, closes)
+	}
+}
@@ -2,134 +2,446 @@ package stdio
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/windlant/mcp-client/internal/protocol"
 	"github.com/windlant/mcp-client/internal/tools"
+	"github.com/windlant/mcp-client/internal/tools/mcp"
 )
 
-// StdioToolClient 通过子进程的 stdin/stdout 与 MCP 工具服务器通信
+// defaultStartupTimeout 是未指定 StartupTimeout 时等待服务器启动并完成 initialize 握手的最长时间
+const defaultStartupTimeout = 30 * time.Second
+
+// notifyTimeout 是在后台发送取消通知、回复服务器请求的最长时间
+const notifyTimeout = 5 * time.Second
+
+// StdioToolClient 通过子进程的 stdin/stdout 与 MCP 工具服务器通信（JSON-RPC 2.0，每行一条消息）
+// 多个请求可以同时进行：每个请求带有唯一 ID，后台 goroutine 按 ID 将响应分发给等待的调用方，响应可以乱序到达
 type StdioToolClient struct {
-	cmd    *exec.Cmd
-	stdin  *json.Encoder
-	stdout *bufio.Scanner
-	mu     sync.Mutex // 确保请求-响应交互是线程安全的，之后可能有多个client通过stdio访问server
+	cmd       *exec.Cmd
+	stdinPipe io.WriteCloser
+	stdin     *json.Encoder     // 只由 writeLoop 使用，保证每条消息完整地写入 stdin，不与其他消息交错
+	writes    chan writeRequest // 等待 writeLoop 写入的消息
+	nextID    int64             // 最近一次分配的请求 ID，原子递增
+
+	pendingMu sync.Mutex
+	pending   map[string]chan *protocol.JSONRPCMessage // 按请求 ID 等待响应的调用方
+
+	done    chan struct{} // 子进程 stdout 关闭后关闭
+	readErr error         // 读取结束的原因，仅在 done 关闭后有效
+	server  protocol.InitializeResult
+
+	stderr     *lineRing     // 最近的 stderr 输出，用于诊断服务器异常退出
+	stderrDone chan struct{} // stderr 读完并关闭转发目标后关闭
+	exited     chan struct{} // 子进程退出后关闭
+	exitState  string        // 子进程的退出状态，例如 "exit status 1" 或 "signal: killed"，仅在 exited 关闭后有效
+	exitOK     bool          // 子进程是否以状态码 0 正常退出，仅在 exited 关闭后有效
 }
 
-// NewStdioToolClient 启动一个 MCP 服务器子进程，并建立通信管道
-func NewStdioToolClient(serverBinary string) (*StdioToolClient, error) {
-	cmd := exec.Command(serverBinary)
+// Options 描述如何启动 MCP 服务器子进程
+type Options struct {
+	Command string            // 服务器可执行文件，也可以是 npx、uvx 等启动器
+	Args    []string          // 命令行参数
+	Env     map[string]string // 附加的环境变量，在继承当前进程环境变量的基础上覆盖同名变量
+	Dir     string            // 工作目录，为空时使用当前目录
+
+	StartupTimeout time.Duration // 等待服务器启动并完成握手的最长时间，为 0 时使用 30s
+
+	Stderr      io.WriteCloser // 服务器 stderr 输出（日志、panic 信息）的转发目标，为 nil 时只保留在内存中；客户端在 stderr 读完或启动失败时关闭它
+	StderrLines int            // 保留最近多少行 stderr 用于错误诊断，为 0 时保留 20 行
+
+	// 以下字段仅用于 NewSupervisedClient
+	Restart             RestartPolicy                            // 服务器进程退出后是否重启，为空时使用 RestartOnFailure
+	MaxRestarts         int                                      // 连续重启的次数上限，为 0 时使用 5；进程稳定运行一段时间后重新计数
+	HealthCheckInterval time.Duration                            // 发送 ping 检查服务器是否无响应的间隔，为 0 时使用 30s，小于 0 时不检查
+	Logf                func(format string, args ...interface{}) // 输出重启等事件的日志，为 nil 时不输出
+	OnRestart           func(defs []tools.ToolDefinition)        // 进程重启并重新获取工具列表后调用，传入新进程的工具，为 nil 时不通知
+}
+
+// NewStdioToolClient 启动一个 MCP 服务器子进程，建立通信管道并完成 initialize 握手
+func NewStdioToolClient(opts Options) (*StdioToolClient, error) {
+	// 子进程启动前失败时 stderr 转发目标不会再被使用，在这里关闭；启动后由 captureStderr 在读完时关闭
+	started := false
+	defer func() {
+		if !started && opts.Stderr != nil {
+			_ = opts.Stderr.Close()
+		}
+	}()
+
+	if opts.Command == "" {
+		return nil, fmt.Errorf("server command is required")
+	}
+
+	cmd := exec.Command(opts.Command, opts.Args...)
+	cmd.Dir = opts.Dir
+	if len(opts.Env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range opts.Env {
+			cmd.Env = append(cmd.Env, k+"="+v) // 同名变量以最后出现的为准
+		}
+	}
+	// 让子进程不接收终端的 Ctrl+C，中断只取消当前请求，由 Close 负责结束子进程
+	detachFromTerminalSignals(cmd)
 
 	stdinPipe, err := cmd.StdinPipe()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
 	}
-	stdoutPipe, err := cmd.StdoutPipe()
+	// stdout 与 stderr 使用自行创建的管道而不是 StdoutPipe/StderrPipe，
+	// 这样等待进程退出的 Wait 不必等到管道读完（npx 等启动器的子进程可能继续持有管道）
+	stdoutR, stdoutW, err := os.Pipe()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		stdoutR.Close()
+		stdoutW.Close()
+		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
 
-	if err := cmd.Start(); err != nil {
+	err = cmd.Start()
+	// 写端已由子进程继承，父进程关闭自己的副本，子进程退出后读端才能读到 EOF
+	stdoutW.Close()
+	stderrW.Close()
+	if err != nil {
+		stdoutR.Close()
+		stderrR.Close()
 		return nil, fmt.Errorf("failed to start server process: %w", err)
 	}
+	started = true
+
+	client := newStdioToolClient(stdinPipe, stdoutR, opts.StderrLines)
+	client.cmd = cmd
+	client.stderrDone = make(chan struct{})
+	go captureStderr(stderrR, client.stderr, opts.Stderr, client.stderrDone)
+	go client.wait()
 
-	client := &StdioToolClient{
-		cmd:    cmd,
-		stdin:  json.NewEncoder(stdinPipe),
-		stdout: bufio.NewScanner(stdoutPipe),
+	timeout := opts.StartupTimeout
+	if timeout <= 0 {
+		timeout = defaultStartupTimeout
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	server, err := mcp.Initialize(ctx, client)
+	if err != nil {
+		_ = client.Close()
+		client.drainStderr()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("server did not complete initialization within %s: %w", timeout, err)
+		}
+		return nil, err
+	}
+	client.server = server
 
 	return client, nil
 }
 
-// sendRequest 向子进程发送请求并等待单行 JSON 响应（NDJSON 格式）
-func (c *StdioToolClient) sendRequest(req interface{}) ([]byte, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// newStdioToolClient 在已建立的 stdin/stdout 管道上创建客户端并开始读取响应，
+// 子进程由调用方启动，并负责在子进程退出后关闭 exited
+func newStdioToolClient(stdin io.WriteCloser, stdout io.Reader, stderrLines int) *StdioToolClient {
+	c := &StdioToolClient{
+		stdinPipe: stdin,
+		stdin:     json.NewEncoder(stdin),
+		writes:    make(chan writeRequest),
+		pending:   make(map[string]chan *protocol.JSONRPCMessage),
+		done:      make(chan struct{}),
+		stderr:    newLineRing(stderrLines),
+		exited:    make(chan struct{}),
+	}
+	go c.readLoop(stdout)
+	go c.writeLoop()
+	return c
+}
+
+// ServerInfo 返回握手时服务器上报的协议版本、能力与实现信息
+func (c *StdioToolClient) ServerInfo() protocol.InitializeResult {
+	return c.server
+}
+
+// readLoop 在后台逐行读取子进程的 stdout，将响应分发给对应的调用方，直到管道关闭
+func (c *StdioToolClient) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg protocol.JSONRPCMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue // 忽略非 JSON-RPC 的输出
+		}
 
-	if err := c.stdin.Encode(req); err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		switch {
+		case msg.IsResponse():
+			c.dispatch(&msg)
+		case msg.IsRequest():
+			go c.replyToServer(&msg) // 写入可能阻塞，不能占用读取 goroutine
+		}
+		// 服务器发来的通知（日志、进度、列表变化等）目前忽略
 	}
+	c.readErr = scanner.Err()
+	close(c.done)
+}
+
+// dispatch 将响应交给等待该 ID 的调用方；没有调用方等待（请求已被取消）时丢弃
+func (c *StdioToolClient) dispatch(msg *protocol.JSONRPCMessage) {
+	c.pendingMu.Lock()
+	ch, ok := c.pending[string(msg.ID)]
+	delete(c.pending, string(msg.ID))
+	c.pendingMu.Unlock()
 
-	if c.stdout.Scan() {
-		return c.stdout.Bytes(), nil
+	if ok {
+		ch <- msg // 通道有 1 个缓冲，不会阻塞
 	}
+}
 
-	if err := c.stdout.Err(); err != nil {
-		return nil, fmt.Errorf("error reading response: %w", err)
+// wait 在后台等待子进程退出并记录退出状态
+func (c *StdioToolClient) wait() {
+	err := c.cmd.Wait()
+	switch {
+	case c.cmd.ProcessState != nil:
+		c.exitState = c.cmd.ProcessState.String()
+	case err != nil:
+		c.exitState = err.Error()
 	}
+	c.exitOK = err == nil
+	close(c.exited)
+}
+
+// exitWait 是 stdout 关闭后等待子进程退出、以便报告退出状态的最长时间
+const exitWait = time.Second
 
-	return nil, fmt.Errorf("server closed stdout unexpectedly")
+// closedError 返回子进程 stdout 关闭后的错误，附带退出状态与最近的 stderr 输出
+func (c *StdioToolClient) closedError() error {
+	var err error
+	if c.readErr != nil {
+		err = fmt.Errorf("error reading response: %w", c.readErr)
+	} else {
+		err = fmt.Errorf("server closed stdout unexpectedly")
+	}
+	return c.diagnose(err)
 }
 
-// Call 调用指定名称的工具，并传入参数
-func (c *StdioToolClient) Call(name string, args tools.ToolArguments) (string, error) {
-	req := protocol.MCPToolCallRequest{
-		Method: protocol.MCPMethodCallTool,
-		Name:   name,
-		Args:   args,
+// diagnose 在 err 后附加子进程的退出状态（如果已退出）与最近的 stderr 输出
+func (c *StdioToolClient) diagnose(err error) error {
+	select {
+	case <-c.exited:
+		err = fmt.Errorf("server process exited (%s): %w", c.exitState, err)
+	case <-time.After(exitWait):
 	}
 
-	respBytes, err := c.sendRequest(req)
-	if err != nil {
-		return "", err
+	if lines := c.stderr.snapshot(); len(lines) > 0 {
+		err = fmt.Errorf("%w\nlast stderr output:\n%s", err, strings.Join(lines, "\n"))
 	}
+	return err
+}
 
-	var resp protocol.MCPToolCallResponse
-	if err := json.Unmarshal(respBytes, &resp); err != nil {
-		return "", fmt.Errorf("failed to parse tool call response: %w", err)
+// Exited 返回一个在子进程退出后关闭的通道
+func (c *StdioToolClient) Exited() <-chan struct{} {
+	return c.exited
+}
+
+// ExitState 返回子进程的退出状态，进程仍在运行时返回空串
+func (c *StdioToolClient) ExitState() string {
+	select {
+	case <-c.exited:
+		return c.exitState
+	default:
+		return ""
 	}
+}
 
-	if resp.Error != "" {
-		return "", fmt.Errorf("tool error: %s", resp.Error)
+// ExitedCleanly 报告子进程是否已经以状态码 0 正常退出
+func (c *StdioToolClient) ExitedCleanly() bool {
+	select {
+	case <-c.exited:
+		return c.exitOK
+	default:
+		return false
 	}
+}
 
-	return resp.Result, nil
+// StderrTail 返回最近的 stderr 输出
+func (c *StdioToolClient) StderrTail() []string {
+	return c.stderr.snapshot()
 }
 
-// List 获取服务器支持的所有工具定义
-func (c *StdioToolClient) List() ([]tools.ToolDefinition, error) {
-	req := protocol.MCPListToolsRequest{
-		Method: protocol.MCPMethodListTools,
+// writeRequest 是一条等待写入 stdin 的消息，写入结果通过 err 返回
+type writeRequest struct {
+	msg interface{}
+	err chan error
+}
+
+// writeLoop 逐条写入消息，直到子进程的 stdout 关闭
+func (c *StdioToolClient) writeLoop() {
+	for {
+		select {
+		case w := <-c.writes:
+			w.err <- c.stdin.Encode(w.msg)
+		case <-c.done:
+			return
+		}
 	}
+}
 
-	respBytes, err := c.sendRequest(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send list_tools request: %w", err)
+// write 将一条消息作为单独的一行写入子进程的 stdin
+// 子进程不读取 stdin 时管道写满后写入会一直阻塞，因此写入交给 writeLoop，调用方最多等到 ctx 结束
+func (c *StdioToolClient) write(ctx context.Context, msg interface{}) error {
+	w := writeRequest{msg: msg, err: make(chan error, 1)}
+	select {
+	case c.writes <- w:
+	case <-c.done:
+		return errors.New("server closed stdout")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-w.err:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Request 向子进程发送 JSON-RPC 请求并等待 ID 相同的响应，返回其 result
+// ctx 被取消时向服务器发送 notifications/cancelled 并立即返回，迟到的响应会被丢弃
+func (c *StdioToolClient) Request(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	id := protocol.IntID(atomic.AddInt64(&c.nextID, 1))
+	ch := make(chan *protocol.JSONRPCMessage, 1)
+
+	c.pendingMu.Lock()
+	c.pending[string(id)] = ch
+	c.pendingMu.Unlock()
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, string(id))
+		c.pendingMu.Unlock()
+	}()
+
+	if err := c.write(ctx, protocol.NewRequest(id, method, params)); err != nil {
+		if ctx.Err() != nil {
+			// 请求可能已经交给 writeLoop，稍后仍会写出
+			c.cancel(id, method, ctx.Err())
+			return nil, ctx.Err()
+		}
+		return nil, c.diagnose(fmt.Errorf("failed to send request: %w", err))
+	}
+
+	select {
+	case msg := <-ch:
+		return resultOf(msg)
+	case <-c.done:
+		// readLoop 先分发响应再关闭 done，两者同时就绪时 select 可能选中这里
+		select {
+		case msg := <-ch:
+			return resultOf(msg)
+		default:
+		}
+		return nil, c.closedError()
+	case <-ctx.Done():
+		c.cancel(id, method, ctx.Err())
+		return nil, ctx.Err()
+	}
+}
+
+// resultOf 返回响应中的 result，JSON-RPC 错误以 *protocol.JSONRPCError 返回
+func resultOf(msg *protocol.JSONRPCMessage) (json.RawMessage, error) {
+	if msg.Error != nil {
+		return nil, msg.Error
+	}
+	return msg.Result, nil
+}
+
+// cancel 在后台向服务器发送 notifications/cancelled，不阻塞已经放弃等待的调用方
+// 规范要求 initialize 请求不能被取消
+func (c *StdioToolClient) cancel(id json.RawMessage, method string, reason error) {
+	if method == protocol.MethodInitialize {
+		return
 	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		_ = c.write(ctx, protocol.NewNotification(protocol.MethodCancelled, protocol.CancelledParams{
+			RequestID: id,
+			Reason:    reason.Error(),
+		}))
+	}()
+}
 
-	var resp protocol.MCPListToolsResponse
-	if err := json.Unmarshal(respBytes, &resp); err != nil {
-		return nil, fmt.Errorf("failed to parse list_tools response: %w", err)
+// hasPending 报告是否有尚未收到响应的请求
+func (c *StdioToolClient) hasPending() bool {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	return len(c.pending) > 0
+}
+
+// replyToServer 响应服务器主动发来的请求
+func (c *StdioToolClient) replyToServer(msg *protocol.JSONRPCMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	_ = c.write(ctx, mcp.ServerRequestResponse(msg))
+}
+
+// Notify 向子进程发送 JSON-RPC 通知，不等待响应
+func (c *StdioToolClient) Notify(ctx context.Context, method string, params interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := c.write(ctx, protocol.NewNotification(method, params)); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
 	}
+	return nil
+}
+
+// Call 调用指定名称的工具，并传入参数
+func (c *StdioToolClient) Call(ctx context.Context, name string, args tools.ToolArguments) (string, error) {
+	return mcp.CallTool(ctx, c, name, args)
+}
 
-	return resp.Tools, nil
+// List 获取服务器支持的所有工具定义
+func (c *StdioToolClient) List(ctx context.Context) ([]tools.ToolDefinition, error) {
+	return mcp.ListTools(ctx, c)
 }
 
-// Close 优雅关闭子进程：先发送中断信号，超时后强制终止
+// Close 优雅关闭子进程：先关闭 stdin 并发送中断信号，超时后强制终止
 func (c *StdioToolClient) Close() error {
 	if c.cmd.Process == nil {
 		return nil
 	}
 
+	_ = c.stdinPipe.Close()
 	_ = c.cmd.Process.Signal(os.Interrupt)
 
-	done := make(chan error, 1)
-	go func() {
-		done <- c.cmd.Wait()
-	}()
-
 	select {
-	case <-done:
+	case <-c.exited:
 		return nil
 	case <-time.After(2 * time.Second):
-		_ = c.cmd.Process.Kill()
-		_ = c.cmd.Wait()
+		c.kill()
 		return nil
 	}
 }
+
+// drainStderr 等待 stderr 读完并关闭转发目标，最多等待 stderrDrainTimeout
+func (c *StdioToolClient) drainStderr() {
+	select {
+	case <-c.stderrDone:
+	case <-time.After(stderrDrainTimeout):
+	}
+}
+
+// kill 强制终止子进程并等待其退出，用于无响应的服务器
+func (c *StdioToolClient) kill() {
+	_ = c.cmd.Process.Kill()
+	<-c.exited
+}
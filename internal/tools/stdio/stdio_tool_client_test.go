@@ -0,0 +1,249 @@
+package stdio
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// fakeServer 通过 io.Pipe 与客户端通信的进程内 MCP 服务器，由测试逐条读取请求并决定何时、以何种顺序响应
+type fakeServer struct {
+	t       *testing.T
+	in      *io.PipeReader
+	scanner *bufio.Scanner
+	out     *io.PipeWriter
+	mu      sync.Mutex // 串行化响应的写入
+}
+
+// newFakeClient 创建一个连接到 fakeServer 的客户端
+func newFakeClient(t *testing.T) (*StdioToolClient, *fakeServer) {
+	t.Helper()
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+
+	c := newStdioToolClient(reqW, respR, 5)
+	s := &fakeServer{t: t, in: reqR, scanner: bufio.NewScanner(reqR), out: respW}
+	t.Cleanup(func() {
+		reqR.Close()
+		respW.Close()
+	})
+	return c, s
+}
+
+// next 读取客户端发来的下一条消息
+func (s *fakeServer) next() protocol.JSONRPCMessage {
+	s.t.Helper()
+	if !s.scanner.Scan() {
+		s.t.Fatalf("client closed stdin: %v", s.scanner.Err())
+	}
+	var msg protocol.JSONRPCMessage
+	if err := json.Unmarshal(s.scanner.Bytes(), &msg); err != nil {
+		s.t.Fatalf("invalid message %q: %v", s.scanner.Text(), err)
+	}
+	return msg
+}
+
+// reply 以工具结果响应一个 tools/call 请求，结果文本为参数 n 的值
+func (s *fakeServer) reply(req protocol.JSONRPCMessage) {
+	s.t.Helper()
+	var params protocol.CallToolParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		s.t.Fatalf("invalid tools/call params: %v", err)
+	}
+	result := protocol.CallToolResult{
+		Content: []protocol.Content{protocol.TextContent(fmt.Sprint(params.Arguments["n"]))},
+	}
+	data, err := json.Marshal(protocol.NewResult(req.ID, result))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.out.Write(append(data, '\n')); err != nil {
+		s.t.Fatalf("failed to write response: %v", err)
+	}
+}
+
+func TestParallelCallsWithOutOfOrderResponses(t *testing.T) {
+	const n = 200
+	c, s := newFakeClient(t)
+
+	// 收齐全部请求后打乱顺序再响应，每个调用方必须拿到自己的结果
+	go func() {
+		reqs := make([]protocol.JSONRPCMessage, 0, n)
+		for len(reqs) < n {
+			msg := s.next()
+			if msg.Method != protocol.MethodToolsCall {
+				t.Errorf("unexpected method %q", msg.Method)
+				return
+			}
+			reqs = append(reqs, msg)
+		}
+		r := rand.New(rand.NewSource(1))
+		r.Shuffle(len(reqs), func(i, j int) { reqs[i], reqs[j] = reqs[j], reqs[i] })
+		for _, req := range reqs {
+			s.reply(req)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got, err := c.Call(ctx, "echo", tools.ToolArguments{"n": i})
+			if err != nil {
+				errs <- fmt.Errorf("call %d: %w", i, err)
+				return
+			}
+			if want := fmt.Sprint(i); got != want {
+				errs <- fmt.Errorf("call %d got result %q", i, got)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if c.hasPending() {
+		t.Error("pending requests left after all calls returned")
+	}
+}
+
+func TestCancelledCallSendsNotification(t *testing.T) {
+	c, s := newFakeClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.Call(ctx, "slow", tools.ToolArguments{"n": 1})
+		errCh <- err
+	}()
+
+	req := s.next()
+	cancel()
+	// 调用立即返回，通知在后台写出
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want context.Canceled", err)
+	}
+	note := s.next()
+
+	if note.Method != protocol.MethodCancelled {
+		t.Fatalf("got %q, want %s", note.Method, protocol.MethodCancelled)
+	}
+	var params protocol.CancelledParams
+	if err := json.Unmarshal(note.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	if string(params.RequestID) != string(req.ID) {
+		t.Fatalf("cancelled request %s, want %s", params.RequestID, req.ID)
+	}
+
+	// 取消后才到达的响应被丢弃，不影响后续调用
+	s.reply(req)
+	go func() { s.reply(s.next()) }()
+	got, err := c.Call(context.Background(), "echo", tools.ToolArguments{"n": 2})
+	if err != nil || got != "2" {
+		t.Fatalf("got %q, %v after a cancelled call", got, err)
+	}
+}
+
+func TestServerExitFailsPendingCalls(t *testing.T) {
+	c, s := newFakeClient(t)
+
+	const n = 5
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			_, err := c.Call(context.Background(), "echo", tools.ToolArguments{"n": i})
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < n; i++ {
+		s.next()
+	}
+
+	// 模拟子进程崩溃：输出 stderr、关闭 stdin 与 stdout 并退出
+	c.stderr.add("panic: boom")
+	c.exitState = "exit status 2"
+	close(c.exited)
+	s.in.Close()
+	s.out.Close()
+
+	for i := 0; i < n; i++ {
+		err := <-errs
+		if err == nil {
+			t.Fatal("call succeeded after the server exited")
+		}
+		for _, want := range []string{"exit status 2", "server closed stdout unexpectedly", "panic: boom"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error %q does not mention %q", err, want)
+			}
+		}
+	}
+
+	// 之后的调用立即失败而不是挂起
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.Call(ctx, "echo", tools.ToolArguments{"n": 1}); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want an immediate error", err)
+	}
+}
+
+func TestResponseBeforeStdoutClosesIsNotLost(t *testing.T) {
+	// 服务器写出响应后立即关闭 stdout，响应与 done 几乎同时就绪
+	for i := 0; i < 200; i++ {
+		c, s := newFakeClient(t)
+		go func() {
+			s.reply(s.next())
+			s.out.Close()
+		}()
+		got, err := c.Call(context.Background(), "echo", tools.ToolArguments{"n": i})
+		if err != nil || got != fmt.Sprint(i) {
+			t.Fatalf("iteration %d: got %q, %v", i, got, err)
+		}
+	}
+}
+
+func TestStuckStdinDoesNotOutliveDeadline(t *testing.T) {
+	// 服务器从不读取 stdin，io.Pipe 的写入会一直阻塞
+	c, _ := newFakeClient(t)
+
+	const callers = 3
+	errs := make(chan error, callers)
+	start := time.Now()
+	for i := 0; i < callers; i++ {
+		go func(i int) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			_, err := c.Call(ctx, "echo", tools.ToolArguments{"n": i})
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < callers; i++ {
+		if err := <-errs; !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want context.DeadlineExceeded", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("calls returned after %s, past their 100ms deadline", elapsed)
+	}
+}
@@ -0,0 +1,354 @@
+package stdio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// RestartPolicy 决定服务器进程退出后是否重启
+type RestartPolicy string
+
+const (
+	RestartNever     RestartPolicy = "never"      // 不重启，之后的调用直接返回错误
+	RestartOnFailure RestartPolicy = "on-failure" // 仅在进程异常退出（非 0 状态码、被信号终止或健康检查失败）时重启
+	RestartAlways    RestartPolicy = "always"     // 进程正常退出也重启
+)
+
+const (
+	defaultMaxRestarts         = 5
+	defaultHealthCheckInterval = 30 * time.Second
+	pingTimeout                = 10 * time.Second // 健康检查等待 ping 响应的最长时间，不超过检查间隔，超时视为服务器无响应
+	restartInitialBackoff      = time.Second
+	restartMaxBackoff          = 30 * time.Second
+	stableRunTime              = 10 * time.Minute // 进程连续运行超过该时间后重启计数清零
+)
+
+var (
+	errServerStopped = errors.New("server is not running")
+	errClientClosed  = errors.New("client is closed")
+)
+
+// SupervisedClient 在 StdioToolClient 之上监管服务器子进程：
+// 进程退出后按重启策略以指数退避重新启动、完成握手并重新获取工具列表（通过 Options.OnRestart 通知调用方），
+// 并定期发送 ping，在服务器无响应时终止进程以触发重启
+// 进程退出时尚未完成的调用返回错误而不重试（工具调用不一定是幂等的），重启期间发起的调用等待新进程就绪
+type SupervisedClient struct {
+	opts        Options
+	sink        io.WriteCloser // 各子进程共用的 stderr 转发目标，Close 时关闭
+	maxRestarts int
+	interval    time.Duration
+
+	mu     sync.Mutex
+	client *StdioToolClient // 当前的子进程，重启期间为 nil
+	ready  chan struct{}    // client 可用或放弃重启后关闭
+	err    error            // 放弃重启的原因，设置后所有调用直接返回该错误
+	closed chan struct{}
+}
+
+// NewSupervisedClient 启动服务器子进程并开始监管，首次启动失败时直接返回错误
+// 与 NewStdioToolClient 相同，opts.Stderr 由客户端负责关闭，但在所有重启之间共用，直到 Close 时才关闭
+func NewSupervisedClient(opts Options) (*SupervisedClient, error) {
+	sink := opts.Stderr
+	if sink != nil {
+		opts.Stderr = sharedSink{sink}
+	}
+	closeSink := func() {
+		if sink != nil {
+			_ = sink.Close()
+		}
+	}
+
+	switch opts.Restart {
+	case "":
+		opts.Restart = RestartOnFailure
+	case RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		closeSink()
+		return nil, fmt.Errorf("unknown restart policy %q (want never, on-failure or always)", opts.Restart)
+	}
+
+	client, err := NewStdioToolClient(opts)
+	if err != nil {
+		closeSink()
+		return nil, err
+	}
+
+	s := &SupervisedClient{
+		opts:        opts,
+		sink:        sink,
+		maxRestarts: opts.MaxRestarts,
+		interval:    opts.HealthCheckInterval,
+		client:      client,
+		ready:       make(chan struct{}),
+		closed:      make(chan struct{}),
+	}
+	if s.maxRestarts <= 0 {
+		s.maxRestarts = defaultMaxRestarts
+	}
+	if s.interval == 0 {
+		s.interval = defaultHealthCheckInterval
+	}
+	close(s.ready)
+
+	go s.supervise(client)
+	return s, nil
+}
+
+// ServerInfo 返回当前服务器进程握手时上报的信息，重启期间返回空值
+func (s *SupervisedClient) ServerInfo() protocol.InitializeResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		return protocol.InitializeResult{}
+	}
+	return s.client.ServerInfo()
+}
+
+// Call 调用指定名称的工具，服务器正在重启时等待其就绪
+func (s *SupervisedClient) Call(ctx context.Context, name string, args tools.ToolArguments) (string, error) {
+	c, err := s.current(ctx)
+	if err != nil {
+		return "", err
+	}
+	return c.Call(ctx, name, args)
+}
+
+// List 获取服务器支持的所有工具定义，服务器正在重启时等待其就绪
+func (s *SupervisedClient) List(ctx context.Context) ([]tools.ToolDefinition, error) {
+	c, err := s.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.List(ctx)
+}
+
+// Close 停止监管，关闭当前的服务器进程与 stderr 转发目标
+func (s *SupervisedClient) Close() error {
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return nil
+	default:
+	}
+	close(s.closed)
+	c := s.client
+	s.mu.Unlock()
+
+	var err error
+	if c != nil {
+		err = c.Close()
+		// 转发完进程退出前的最后几行 stderr 再关闭
+		c.drainStderr()
+	}
+	if s.sink != nil {
+		_ = s.sink.Close()
+	}
+	return err
+}
+
+// current 返回当前可用的子进程，重启期间等待新进程就绪
+func (s *SupervisedClient) current(ctx context.Context) (*StdioToolClient, error) {
+	for {
+		s.mu.Lock()
+		c, ready, err := s.client, s.ready, s.err
+		s.mu.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			select {
+			case <-c.Exited():
+				// 进程刚刚退出而 supervise 尚未处理，等待其重启或放弃
+				s.detach(c)
+			default:
+				return c, nil
+			}
+		}
+
+		select {
+		case <-ready:
+		case <-s.closed:
+			return nil, errClientClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// supervise 等待子进程退出，并按重启策略重启，直到客户端关闭或放弃重启
+func (s *SupervisedClient) supervise(c *StdioToolClient) {
+	restarts := 0
+	for {
+		started := time.Now()
+		if s.interval > 0 {
+			go s.healthCheck(c)
+		}
+
+		select {
+		case <-c.Exited():
+		case <-s.closed:
+			return
+		}
+		// Close 先关闭 closed 再结束进程，因此进程因 Close 退出时这里一定能看到
+		select {
+		case <-s.closed:
+			return
+		default:
+		}
+
+		lastErr := c.diagnose(errServerStopped)
+		if s.opts.Restart == RestartNever || (s.opts.Restart == RestartOnFailure && c.ExitedCleanly()) {
+			s.giveUp(lastErr)
+			return
+		}
+		if time.Since(started) >= stableRunTime {
+			restarts = 0
+		}
+		s.detach(c)
+		s.logf("server exited (%s), restarting", c.ExitState())
+
+		backoff := restartInitialBackoff
+		for c = nil; c == nil; {
+			if restarts >= s.maxRestarts {
+				s.giveUp(fmt.Errorf("giving up after %d restarts: %w", restarts, lastErr))
+				s.logf("giving up after %d restarts", restarts)
+				return
+			}
+			select {
+			case <-time.After(backoff):
+			case <-s.closed:
+				return
+			}
+
+			restarts++
+			next, defs, err := s.start()
+			if err != nil {
+				lastErr = err
+				s.logf("restart %d of %d failed: %v", restarts, s.maxRestarts, err)
+				backoff *= 2
+				if backoff > restartMaxBackoff {
+					backoff = restartMaxBackoff
+				}
+				continue
+			}
+			if !s.setClient(next) {
+				// Close 在重启期间被调用，新进程不再需要
+				_ = next.Close()
+				return
+			}
+			s.logf("server restarted with %d tools (restart %d of %d)", len(defs), restarts, s.maxRestarts)
+			if s.opts.OnRestart != nil {
+				// 新进程的工具可能与之前不同，交给调用方更新缓存的工具列表与路由
+				s.opts.OnRestart(defs)
+			}
+			c = next
+		}
+	}
+}
+
+// start 启动一个新的子进程并重新获取工具列表，确认新进程能正常提供工具
+func (s *SupervisedClient) start() (*StdioToolClient, []tools.ToolDefinition, error) {
+	c, err := NewStdioToolClient(s.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	timeout := s.opts.StartupTimeout
+	if timeout <= 0 {
+		timeout = defaultStartupTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	defs, err := c.List(ctx)
+	if err != nil {
+		_ = c.Close()
+		return nil, nil, fmt.Errorf("failed to list tools: %w", err)
+	}
+	return c, defs, nil
+}
+
+// healthCheck 定期向子进程发送 ping，超时或失败时强制终止进程，由 supervise 按策略重启
+// 有请求正在进行时跳过本次检查，避免逐个处理请求的服务器因忙于耗时的工具调用而被误判为无响应
+func (s *SupervisedClient) healthCheck(c *StdioToolClient) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.Exited():
+			return
+		}
+		if c.hasPending() {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), min(pingTimeout, s.interval))
+		_, err := c.Request(ctx, protocol.MethodPing, nil)
+		cancel()
+		if err == nil {
+			continue
+		}
+
+		select {
+		case <-c.Exited():
+			// 进程已经退出，由 supervise 处理
+		default:
+			s.logf("health check failed, killing server: %v", err)
+			c.kill()
+		}
+		return
+	}
+}
+
+// detach 在子进程 c 退出后将其移除，之后的调用等待重启完成
+func (s *SupervisedClient) detach(c *StdioToolClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == c {
+		s.client = nil
+		s.ready = make(chan struct{})
+	}
+}
+
+// setClient 设置重启后的子进程，客户端已关闭时返回 false
+func (s *SupervisedClient) setClient(c *StdioToolClient) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.closed:
+		return false
+	default:
+	}
+
+	s.client = c
+	close(s.ready)
+	return true
+}
+
+// giveUp 停止重启，之后的调用都返回 err
+func (s *SupervisedClient) giveUp(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		// 重启期间 ready 尚未关闭，关闭它唤醒等待中的调用
+		close(s.ready)
+	}
+	s.client = nil
+	s.err = err
+}
+
+// logf 输出监管事件的日志
+func (s *SupervisedClient) logf(format string, args ...interface{}) {
+	if s.opts.Logf != nil {
+		s.opts.Logf(format, args...)
+	}
+}
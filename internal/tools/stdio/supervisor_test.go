@@ -0,0 +1,280 @@
+package stdio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windlant/mcp-client/internal/protocol"
+	"github.com/windlant/mcp-client/internal/tools"
+)
+
+// 辅助服务器的运行方式，通过环境变量 HELPER_MODE 传给子进程
+const (
+	helperNormal         = ""                 // 正常响应所有请求
+	helperHangFirstPing  = "hang-first-ping"  // 第一次启动的进程不响应 ping
+	helperCrashOnRestart = "crash-on-restart" // 第一次之后的启动都在握手前以状态码 1 退出
+)
+
+// TestHelperProcess 不是真正的测试：supervisor 测试把测试二进制作为 MCP 服务器子进程重新运行，
+// 每次启动把启动次数记录在 HELPER_STATE 文件中，工具列表为 "tool_v<启动次数>"，调用 "exit" 工具时以参数 code 退出
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	os.Exit(runHelperServer(os.Getenv("HELPER_MODE"), os.Getenv("HELPER_STATE")))
+}
+
+func runHelperServer(mode, state string) int {
+	starts := 1
+	if data, err := os.ReadFile(state); err == nil {
+		starts, _ = strconv.Atoi(string(data))
+		starts++
+	}
+	if err := os.WriteFile(state, []byte(strconv.Itoa(starts)), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if mode == helperCrashOnRestart && starts > 1 {
+		fmt.Fprintln(os.Stderr, "crashing on start", starts)
+		return 1
+	}
+
+	dec := json.NewDecoder(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		var msg protocol.JSONRPCMessage
+		if err := dec.Decode(&msg); err != nil {
+			return 0
+		}
+		if !msg.IsRequest() {
+			continue
+		}
+
+		var result interface{}
+		switch msg.Method {
+		case protocol.MethodInitialize:
+			result = protocol.InitializeResult{
+				ProtocolVersion: protocol.LatestProtocolVersion,
+				ServerInfo:      protocol.Implementation{Name: "helper", Version: strconv.Itoa(starts)},
+			}
+		case protocol.MethodPing:
+			if mode == helperHangFirstPing && starts == 1 {
+				continue
+			}
+			result = struct{}{}
+		case protocol.MethodToolsList:
+			result = protocol.ListToolsResult{Tools: []protocol.Tool{{
+				Name:        fmt.Sprintf("tool_v%d", starts),
+				InputSchema: tools.Schema{Type: tools.SchemaType{"object"}},
+			}}}
+		case protocol.MethodToolsCall:
+			var params protocol.CallToolParams
+			_ = json.Unmarshal(msg.Params, &params)
+			if params.Name == "exit" {
+				code, _ := params.Arguments["code"].(float64)
+				return int(code)
+			}
+			result = protocol.CallToolResult{Content: []protocol.Content{protocol.TextContent("ok")}}
+		}
+		if err := enc.Encode(protocol.NewResult(msg.ID, result)); err != nil {
+			return 0
+		}
+	}
+}
+
+// supervisorEvents 记录监管器的日志与重启通知
+type supervisorEvents struct {
+	mu       sync.Mutex
+	logs     []string
+	restarts chan []tools.ToolDefinition
+}
+
+func (e *supervisorEvents) logf(format string, args ...interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.logs = append(e.logs, fmt.Sprintf(format, args...))
+}
+
+// logged 返回包含 substr 的日志条数
+func (e *supervisorEvents) logged(substr string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := 0
+	for _, line := range e.logs {
+		if strings.Contains(line, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+// newHelperClient 以 mode 启动被监管的辅助服务器
+func newHelperClient(t *testing.T, mode string, opts Options) (*SupervisedClient, *supervisorEvents) {
+	t.Helper()
+	events := &supervisorEvents{restarts: make(chan []tools.ToolDefinition, 10)}
+
+	opts.Command = os.Args[0]
+	opts.Args = []string{"-test.run=^TestHelperProcess$"}
+	opts.Env = map[string]string{
+		"GO_WANT_HELPER_PROCESS": "1",
+		"HELPER_MODE":            mode,
+		"HELPER_STATE":           filepath.Join(t.TempDir(), "starts"),
+	}
+	opts.StartupTimeout = 10 * time.Second
+	opts.Logf = events.logf
+	opts.OnRestart = func(defs []tools.ToolDefinition) { events.restarts <- defs }
+	if opts.HealthCheckInterval == 0 {
+		opts.HealthCheckInterval = -1
+	}
+
+	s, err := NewSupervisedClient(opts)
+	if err != nil {
+		t.Fatalf("failed to start helper server: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s, events
+}
+
+// exitServer 让辅助服务器以 code 退出
+func exitServer(t *testing.T, s *SupervisedClient, code int) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := s.Call(ctx, "exit", tools.ToolArguments{"code": code}); err == nil {
+		t.Fatal("call to exit returned a result, want the server to exit")
+	}
+}
+
+// listTools 返回当前服务器的工具名，重启期间等待其就绪
+func listTools(s *SupervisedClient) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	defs, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(defs))
+	for _, def := range defs {
+		names = append(names, def.Name)
+	}
+	return names, nil
+}
+
+func waitRestart(t *testing.T, events *supervisorEvents) []tools.ToolDefinition {
+	t.Helper()
+	select {
+	case defs := <-events.restarts:
+		return defs
+	case <-time.After(10 * time.Second):
+		t.Fatal("server was not restarted")
+		return nil
+	}
+}
+
+func TestRestartPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RestartPolicy
+		code    int
+		restart bool
+	}{
+		{"on-failure restarts a crash", RestartOnFailure, 1, true},
+		{"on-failure keeps a clean exit down", RestartOnFailure, 0, false},
+		{"always restarts a clean exit", RestartAlways, 0, true},
+		{"never keeps a crash down", RestartNever, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, events := newHelperClient(t, helperNormal, Options{Restart: tt.policy})
+			if names, err := listTools(s); err != nil || len(names) != 1 || names[0] != "tool_v1" {
+				t.Fatalf("tools = %v, %v; want [tool_v1]", names, err)
+			}
+
+			exitServer(t, s, tt.code)
+			names, err := listTools(s)
+
+			if !tt.restart {
+				if err == nil {
+					t.Fatalf("List after exit = %v, want an error", names)
+				}
+				if !strings.Contains(err.Error(), fmt.Sprintf("exit status %d", tt.code)) && tt.code != 0 {
+					t.Errorf("error %q does not report the exit status", err)
+				}
+				select {
+				case <-events.restarts:
+					t.Error("server was restarted")
+				default:
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("List after restart failed: %v", err)
+			}
+			if len(names) != 1 || names[0] != "tool_v2" {
+				t.Errorf("tools after restart = %v, want [tool_v2]", names)
+			}
+			defs := waitRestart(t, events)
+			if len(defs) != 1 || defs[0].Name != "tool_v2" {
+				t.Errorf("OnRestart received %v, want tool_v2", defs)
+			}
+			if got := s.ServerInfo().ServerInfo.Version; got != "2" {
+				t.Errorf("server info version = %q, want 2", got)
+			}
+		})
+	}
+}
+
+func TestRestartBacksOffAndGivesUp(t *testing.T) {
+	s, events := newHelperClient(t, helperCrashOnRestart, Options{MaxRestarts: 2})
+
+	start := time.Now()
+	exitServer(t, s, 1)
+	_, err := listTools(s)
+	elapsed := time.Since(start)
+
+	if err == nil || !strings.Contains(err.Error(), "giving up after 2 restarts") {
+		t.Fatalf("List error = %v, want giving up after 2 restarts", err)
+	}
+	// 两次重启之间的等待为 1s 与 2s
+	if want := restartInitialBackoff + 2*restartInitialBackoff; elapsed < want {
+		t.Errorf("gave up after %v, want at least %v of backoff", elapsed, want)
+	}
+	if n := events.logged("failed"); n != 2 {
+		t.Errorf("logged %d failed restarts, want 2", n)
+	}
+	select {
+	case <-events.restarts:
+		t.Error("OnRestart called for a server that never came back")
+	default:
+	}
+}
+
+func TestHealthCheckKillsUnresponsiveServer(t *testing.T) {
+	s, events := newHelperClient(t, helperHangFirstPing, Options{HealthCheckInterval: 100 * time.Millisecond})
+
+	defs := waitRestart(t, events)
+	if len(defs) != 1 || defs[0].Name != "tool_v2" {
+		t.Errorf("OnRestart received %v, want tool_v2", defs)
+	}
+	if events.logged("health check failed") != 1 {
+		t.Error("health check failure not logged")
+	}
+
+	// 新进程正常响应 ping，不会再被终止
+	time.Sleep(500 * time.Millisecond)
+	if names, err := listTools(s); err != nil || len(names) != 1 || names[0] != "tool_v2" {
+		t.Errorf("tools = %v, %v; want [tool_v2]", names, err)
+	}
+	if n := events.logged("health check failed"); n != 1 {
+		t.Errorf("health check failed %d times, want 1", n)
+	}
+}
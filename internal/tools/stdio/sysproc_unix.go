@@ -0,0 +1,13 @@
+//go:build !windows
+
+package stdio
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachFromTerminalSignals 将子进程放入独立的进程组，使终端的 Ctrl+C 不会直接发送给它
+func detachFromTerminalSignals(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package stdio
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachFromTerminalSignals 将子进程放入新的进程组，使控制台的 Ctrl+C 不会直接发送给它
+func detachFromTerminalSignals(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
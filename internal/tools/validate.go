@@ -0,0 +1,467 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidArguments 表示工具参数不符合工具的输入 schema，可用 errors.Is 判断
+var ErrInvalidArguments = errors.New("invalid arguments")
+
+// ValidationIssue 描述参数中的一处问题
+type ValidationIssue struct {
+	Path    string `json:"path"`    // 出错的位置，例如 "edits[0].oldText"，参数整体为空串
+	Message string `json:"message"` // 问题说明，例如 "expected integer, got string \"abc\""
+}
+
+// ValidationError 列出参数中的全部问题，错误信息逐行说明每处问题，作为工具结果返回给模型以便其修正后重试
+type ValidationError struct {
+	Issues []ValidationIssue
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString(ErrInvalidArguments.Error())
+	b.WriteString(", fix the following and call the tool again:")
+	for _, issue := range e.Issues {
+		b.WriteString("\n- ")
+		if issue.Path != "" {
+			b.WriteString(issue.Path)
+			b.WriteString(": ")
+		}
+		b.WriteString(issue.Message)
+	}
+	return b.String()
+}
+
+// Is 使 errors.Is(err, ErrInvalidArguments) 成立
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidArguments
+}
+
+// Validate 按 schema 校验工具参数，返回校验并转换后的参数副本，不修改 args
+// 类型不符但可以无损转换的值会被转换，例如模型常把数字写成 "5"、把布尔值写成 "true"、把数组或对象写成 JSON 字符串；
+// 不符合 schema 的参数返回 *ValidationError。format 只是说明，不做校验；$ref 等未解析的关键字被忽略
+func (s Schema) Validate(args ToolArguments) (ToolArguments, error) {
+	var v validator
+	value := v.validate(&s, map[string]interface{}(args), "")
+	if len(v.issues) > 0 {
+		return nil, &ValidationError{Issues: v.issues}
+	}
+	if obj, ok := value.(map[string]interface{}); ok {
+		return ToolArguments(obj), nil
+	}
+	// 参数整体总是对象，schema 不是对象类型时原样返回
+	return args, nil
+}
+
+// validator 在遍历参数时收集问题
+type validator struct {
+	issues []ValidationIssue
+}
+
+func (v *validator) addf(path, format string, args ...interface{}) {
+	v.issues = append(v.issues, ValidationIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// validate 校验 value 并返回转换后的值；s 为 nil 时接受任意值
+func (v *validator) validate(s *Schema, value interface{}, path string) interface{} {
+	if s == nil {
+		return value
+	}
+	if s.Bool != nil {
+		if !*s.Bool {
+			v.addf(path, "no value is allowed here")
+		}
+		return value
+	}
+	if m, ok := value.(ToolArguments); ok {
+		value = map[string]interface{}(m)
+	}
+
+	if s.Type != nil {
+		coerced, ok := coerceToType(s.Type, value)
+		if !ok {
+			v.addf(path, "expected %s, got %s", strings.Join(s.Type, " or "), describe(value))
+			return value
+		}
+		value = coerced
+	}
+
+	if s.Enum != nil && !containsJSON(s.Enum, value) {
+		v.addf(path, "must be one of %s, got %s", compactJSON(s.Enum), describe(value))
+	}
+	if s.Const != nil {
+		var want interface{}
+		if json.Unmarshal(s.Const, &want) == nil && !equalJSON(want, value) {
+			v.addf(path, "must be %s, got %s", compactJSON(want), describe(value))
+		}
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		value = v.validateObject(s, val, path)
+	case []interface{}:
+		value = v.validateArray(s, val, path)
+	case string:
+		v.validateString(s, val, path)
+	default:
+		if n, ok := toFloat(value); ok {
+			v.validateNumber(s, n, path)
+		}
+	}
+
+	return v.validateCombinators(s, value, path)
+}
+
+// validateObject 校验对象的属性，返回转换后的副本
+func (v *validator) validateObject(s *Schema, obj map[string]interface{}, path string) map[string]interface{} {
+	out := make(map[string]interface{}, len(obj))
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			v.addf(joinPath(path, name), "required property is missing")
+		}
+	}
+
+	// 按名称排序，使问题列表的顺序稳定
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop, declared := s.Properties[name]
+		switch {
+		case declared:
+			out[name] = v.validate(prop, obj[name], joinPath(path, name))
+		case s.AdditionalProperties != nil && s.AdditionalProperties.Bool != nil && !*s.AdditionalProperties.Bool:
+			if len(s.Properties) == 0 {
+				v.addf(joinPath(path, name), "unknown property (no properties are accepted here)")
+			} else {
+				v.addf(joinPath(path, name), "unknown property (allowed: %s)", strings.Join(sortedKeys(s.Properties), ", "))
+			}
+		default:
+			out[name] = v.validate(s.AdditionalProperties, obj[name], joinPath(path, name))
+		}
+	}
+	return out
+}
+
+// validateArray 校验数组的元素与长度，返回转换后的副本
+func (v *validator) validateArray(s *Schema, arr []interface{}, path string) []interface{} {
+	if s.MinItems != nil && len(arr) < *s.MinItems {
+		v.addf(path, "must contain at least %d items, got %d", *s.MinItems, len(arr))
+	}
+	if s.MaxItems != nil && len(arr) > *s.MaxItems {
+		v.addf(path, "must contain at most %d items, got %d", *s.MaxItems, len(arr))
+	}
+
+	out := make([]interface{}, len(arr))
+	for i, item := range arr {
+		out[i] = v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i))
+	}
+
+	if s.UniqueItems {
+		seen := make(map[string]bool, len(out))
+		for _, item := range out {
+			key := compactJSON(item)
+			if seen[key] {
+				v.addf(path, "items must be unique, %s appears more than once", key)
+				break
+			}
+			seen[key] = true
+		}
+	}
+	return out
+}
+
+// validateString 校验字符串的长度与模式
+func (v *validator) validateString(s *Schema, str string, path string) {
+	n := utf8.RuneCountInString(str)
+	if s.MinLength != nil && n < *s.MinLength {
+		v.addf(path, "must be at least %d characters long, got %d", *s.MinLength, n)
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		v.addf(path, "must be at most %d characters long, got %d", *s.MaxLength, n)
+	}
+	if s.Pattern != "" {
+		// JSON Schema 使用 ECMA 262 正则，RE2 不支持的写法（如断言）无法编译，此时跳过检查
+		if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(str) {
+			v.addf(path, "must match pattern %q", s.Pattern)
+		}
+	}
+}
+
+// validateNumber 校验数值的范围
+func (v *validator) validateNumber(s *Schema, n float64, path string) {
+	if s.Minimum != nil && n < *s.Minimum {
+		v.addf(path, "must be >= %v, got %v", *s.Minimum, n)
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		v.addf(path, "must be <= %v, got %v", *s.Maximum, n)
+	}
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		if q := n / *s.MultipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.addf(path, "must be a multiple of %v, got %v", *s.MultipleOf, n)
+		}
+	}
+}
+
+// validateCombinators 处理 allOf、anyOf、oneOf 与 not，返回满足条件的分支转换后的值
+func (v *validator) validateCombinators(s *Schema, value interface{}, path string) interface{} {
+	for _, sub := range s.AllOf {
+		value = v.validate(sub, value, path)
+	}
+
+	if s.AnyOf != nil {
+		if matched, ok := firstMatch(s.AnyOf, value, path); ok {
+			value = matched
+		} else {
+			v.addf(path, "does not match any of the allowed schemas (anyOf), got %s", describe(value))
+		}
+	}
+
+	if s.OneOf != nil {
+		count := 0
+		var matched interface{}
+		for _, sub := range s.OneOf {
+			var trial validator
+			out := trial.validate(sub, value, path)
+			if len(trial.issues) == 0 {
+				if count == 0 {
+					matched = out
+				}
+				count++
+			}
+		}
+		switch count {
+		case 0:
+			v.addf(path, "does not match any of the allowed schemas (oneOf), got %s", describe(value))
+		case 1:
+			value = matched
+		default:
+			v.addf(path, "matches %d schemas but must match exactly one (oneOf)", count)
+		}
+	}
+
+	if s.Not != nil {
+		var trial validator
+		trial.validate(s.Not, value, path)
+		if len(trial.issues) == 0 {
+			v.addf(path, "must not match the schema in \"not\"")
+		}
+	}
+	return value
+}
+
+// firstMatch 返回 value 在第一个匹配的 schema 下转换后的值
+func firstMatch(schemas []*Schema, value interface{}, path string) (interface{}, bool) {
+	for _, sub := range schemas {
+		var trial validator
+		out := trial.validate(sub, value, path)
+		if len(trial.issues) == 0 {
+			return out, true
+		}
+	}
+	return nil, false
+}
+
+// coerceToType 检查 value 是否属于 types 中的某个类型；不属于时尝试无损转换，
+// 转换规则：数字字符串转为 number/integer，"true"/"false" 转为 boolean，数字转为 string，
+// 内容为 JSON 数组或对象的字符串转为 array/object
+func coerceToType(types SchemaType, value interface{}) (interface{}, bool) {
+	for _, t := range types {
+		if hasType(t, value) {
+			return value, true
+		}
+	}
+	for _, t := range types {
+		if coerced, ok := coerce(t, value); ok {
+			return coerced, true
+		}
+	}
+	return nil, false
+}
+
+// hasType 报告 value 是否属于 JSON Schema 类型 t
+func hasType(t string, value interface{}) bool {
+	switch t {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := toFloat(value)
+		return ok
+	case "integer":
+		n, ok := toFloat(value)
+		return ok && n == math.Trunc(n) && !math.IsInf(n, 0)
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	default:
+		// 未知的类型名不做限制
+		return true
+	}
+}
+
+// coerce 尝试把 value 无损转换为类型 t
+func coerce(t string, value interface{}) (interface{}, bool) {
+	switch t {
+	case "number", "integer":
+		s, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, false
+		}
+		if t == "integer" && n != math.Trunc(n) {
+			return nil, false
+		}
+		return n, true
+	case "boolean":
+		switch value {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+		return nil, false
+	case "string":
+		if n, ok := toFloat(value); ok {
+			return strconv.FormatFloat(n, 'f', -1, 64), true
+		}
+		return nil, false
+	case "array", "object":
+		s, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(s)), &parsed); err != nil {
+			return nil, false
+		}
+		if hasType(t, parsed) {
+			return parsed, true
+		}
+		return nil, false
+	default:
+		return nil, false
+	}
+}
+
+// toFloat 将 JSON 解码得到的数字或本地调用传入的整数类型转换为 float64
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// describe 返回值的类型与简短内容，用于错误信息
+func describe(value interface{}) string {
+	var kind string
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		kind = "boolean"
+	case string:
+		kind = "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		if _, ok := toFloat(value); ok {
+			kind = "number"
+		} else {
+			return fmt.Sprintf("%T", value)
+		}
+	}
+	text := compactJSON(value)
+	if len(text) > 40 {
+		text = text[:37] + "..."
+	}
+	return kind + " " + text
+}
+
+// containsJSON 报告 values 中是否有与 value 的 JSON 表示相同的值
+func containsJSON(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if equalJSON(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalJSON 按 JSON 表示比较两个值，使 5 与 5.0、不同整数类型的相同数值相等
+func equalJSON(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// compactJSON 返回值的 JSON 表示，用于错误信息
+func compactJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+// joinPath 拼接属性路径
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// sortedKeys 返回按名称排序的属性名
+func sortedKeys(props map[string]*Schema) []string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
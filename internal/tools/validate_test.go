@@ -0,0 +1,205 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		schema string
+		args   string
+		want   string   // 校验通过时转换后的参数
+		issues []string // 校验失败时每处问题的 "路径: 说明" 片段，按顺序
+	}{
+		{
+			name:   "valid arguments are unchanged",
+			schema: `{"type":"object","properties":{"path":{"type":"string"},"count":{"type":"integer"}},"required":["path"]}`,
+			args:   `{"path":"a.txt","count":3}`,
+			want:   `{"path":"a.txt","count":3}`,
+		},
+		{
+			name:   "missing required fields",
+			schema: `{"type":"object","properties":{"path":{"type":"string"},"mode":{"type":"string"}},"required":["path","mode"]}`,
+			args:   `{}`,
+			issues: []string{"path: required property is missing", "mode: required property is missing"},
+		},
+		{
+			name:   "type mismatch",
+			schema: `{"type":"object","properties":{"flag":{"type":"boolean"},"name":{"type":"string"}}}`,
+			args:   `{"flag":"yes","name":{"first":"a"}}`,
+			issues: []string{`flag: expected boolean, got string "yes"`, "name: expected string, got object"},
+		},
+		{
+			name:   "numeric strings are coerced to number and integer",
+			schema: `{"type":"object","properties":{"ratio":{"type":"number"},"count":{"type":"integer"}}}`,
+			args:   `{"ratio":"5","count":" 5 "}`,
+			want:   `{"ratio":5,"count":5}`,
+		},
+		{
+			name:   "fractional string is not an integer",
+			schema: `{"type":"object","properties":{"count":{"type":"integer"}}}`,
+			args:   `{"count":"5.5"}`,
+			issues: []string{`count: expected integer, got string "5.5"`},
+		},
+		{
+			name:   "fractional number is not an integer",
+			schema: `{"type":"object","properties":{"count":{"type":"integer"}}}`,
+			args:   `{"count":5.5}`,
+			issues: []string{"count: expected integer, got number 5.5"},
+		},
+		{
+			name:   "booleans, numbers and JSON strings are coerced",
+			schema: `{"type":"object","properties":{"on":{"type":"boolean"},"id":{"type":"string"},"tags":{"type":"array","items":{"type":"string"}},"opts":{"type":"object"}}}`,
+			args:   `{"on":"false","id":42,"tags":"[\"a\",\"b\"]","opts":"{\"x\":1}"}`,
+			want:   `{"on":false,"id":"42","tags":["a","b"],"opts":{"x":1}}`,
+		},
+		{
+			name:   "enum",
+			schema: `{"type":"object","properties":{"level":{"enum":["low","high"]},"n":{"enum":[1,2]}}}`,
+			args:   `{"level":"medium","n":2.0}`,
+			issues: []string{`level: must be one of ["low","high"], got string "medium"`},
+		},
+		{
+			name:   "nested objects and array items",
+			schema: `{"type":"object","properties":{"edits":{"type":"array","items":{"type":"object","properties":{"oldText":{"type":"string"},"line":{"type":"integer"}},"required":["oldText"]}}}}`,
+			args:   `{"edits":[{"oldText":"a","line":"3"},{"line":"x"}]}`,
+			issues: []string{"edits[1].oldText: required property is missing", `edits[1].line: expected integer, got string "x"`},
+		},
+		{
+			name:   "nested values are coerced",
+			schema: `{"type":"object","properties":{"edits":{"type":"array","items":{"type":"object","properties":{"line":{"type":"integer"}}}}}}`,
+			args:   `{"edits":[{"line":"3"},{"line":4}]}`,
+			want:   `{"edits":[{"line":3},{"line":4}]}`,
+		},
+		{
+			name:   "array and string bounds",
+			schema: `{"type":"object","properties":{"ids":{"type":"array","minItems":1,"uniqueItems":true},"name":{"type":"string","maxLength":3,"pattern":"^[a-z]+$"},"n":{"type":"number","minimum":0,"maximum":10,"multipleOf":0.5}}}`,
+			args:   `{"ids":[1,1],"name":"Abcd","n":10.25}`,
+			issues: []string{"ids: items must be unique", "n: must be <= 10", "n: must be a multiple of 0.5", "name: must be at most 3 characters", `name: must match pattern`},
+		},
+		{
+			name:   "anyOf takes the first matching branch",
+			schema: `{"type":"object","properties":{"due":{"anyOf":[{"type":"integer"},{"type":"string"},{"type":"null"}]}}}`,
+			args:   `{"due":"7"}`,
+			want:   `{"due":7}`,
+		},
+		{
+			name:   "anyOf with no matching branch",
+			schema: `{"type":"object","properties":{"due":{"anyOf":[{"type":"integer"},{"type":"null"}]}}}`,
+			args:   `{"due":true}`,
+			issues: []string{"due: does not match any of the allowed schemas (anyOf), got boolean true"},
+		},
+		{
+			name:   "oneOf with exactly one match",
+			schema: `{"type":"object","properties":{"id":{"oneOf":[{"type":"integer"},{"type":"string","pattern":"^[a-z]+$"}]}}}`,
+			args:   `{"id":"abc"}`,
+			want:   `{"id":"abc"}`,
+		},
+		{
+			name:   "oneOf with several matches",
+			schema: `{"type":"object","properties":{"id":{"oneOf":[{"type":"number"},{"type":"integer"}]}}}`,
+			args:   `{"id":3}`,
+			issues: []string{"id: matches 2 schemas but must match exactly one (oneOf)"},
+		},
+		{
+			name:   "oneOf with no match",
+			schema: `{"type":"object","properties":{"id":{"oneOf":[{"type":"integer"},{"type":"boolean"}]}}}`,
+			args:   `{"id":[1]}`,
+			issues: []string{"id: does not match any of the allowed schemas (oneOf), got array"},
+		},
+		{
+			name:   "additionalProperties false",
+			schema: `{"type":"object","properties":{"path":{"type":"string"},"mode":{"type":"string"}},"additionalProperties":false}`,
+			args:   `{"path":"a","recursive":true}`,
+			issues: []string{"recursive: unknown property (allowed: mode, path)"},
+		},
+		{
+			name:   "additionalProperties false without properties",
+			schema: `{"type":"object","properties":{},"additionalProperties":false}`,
+			args:   `{"x":1}`,
+			issues: []string{"x: unknown property (no properties are accepted here)"},
+		},
+		{
+			name:   "additionalProperties schema",
+			schema: `{"type":"object","additionalProperties":{"type":"integer"}}`,
+			args:   `{"a":"1","b":"x"}`,
+			issues: []string{`b: expected integer, got string "x"`},
+		},
+		{
+			name:   "const and not",
+			schema: `{"type":"object","properties":{"v":{"const":"v1"},"n":{"not":{"const":0}}}}`,
+			args:   `{"v":"v2","n":0}`,
+			issues: []string{`n: must not match the schema in "not"`, `v: must be "v1", got string "v2"`},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var s Schema
+			if err := json.Unmarshal([]byte(tc.schema), &s); err != nil {
+				t.Fatal(err)
+			}
+			var args ToolArguments
+			if err := json.Unmarshal([]byte(tc.args), &args); err != nil {
+				t.Fatal(err)
+			}
+			original := compactJSON(args)
+
+			got, err := s.Validate(args)
+			if compactJSON(args) != original {
+				t.Errorf("Validate modified its input: %s", compactJSON(args))
+			}
+
+			if tc.issues == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				assertSameJSON(t, tc.want, compactJSON(got))
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) || !errors.Is(err, ErrInvalidArguments) {
+				t.Fatalf("got %v, want a *ValidationError", err)
+			}
+			if got != nil {
+				t.Errorf("got arguments %v along with an error", got)
+			}
+			if len(verr.Issues) != len(tc.issues) {
+				t.Fatalf("got issues %q, want %q", verr.Issues, tc.issues)
+			}
+			for i, issue := range verr.Issues {
+				text := issue.Path + ": " + issue.Message
+				if !strings.HasPrefix(text, tc.issues[i]) {
+					t.Errorf("issue %d = %q, want %q", i, text, tc.issues[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	err := &ValidationError{Issues: []ValidationIssue{
+		{Path: "path", Message: "required property is missing"},
+		{Message: "expected object, got string"},
+	}}
+	want := "invalid arguments, fix the following and call the tool again:\n- path: required property is missing\n- expected object, got string"
+	if err.Error() != want {
+		t.Fatalf("got %q", err.Error())
+	}
+}
+
+func TestValidateAcceptsNativeGoValues(t *testing.T) {
+	// 本地工具可能直接传入 Go 的整数类型
+	s := Schema{
+		Type:       SchemaType{"object"},
+		Properties: map[string]*Schema{"n": {Type: SchemaType{"integer"}}},
+	}
+	got, err := s.Validate(ToolArguments{"n": int64(3)})
+	if err != nil || !reflect.DeepEqual(got, ToolArguments{"n": int64(3)}) {
+		t.Fatalf("got %v, %v", got, err)
+	}
+}